@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"io/fs"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep"
+	"github.com/dragon1672/go-keep-export-to-text/keep/config"
+	"github.com/dragon1672/go-keep-export-to-text/keep/diff"
+	"github.com/dragon1672/go-keep-export-to-text/keep/export"
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+	"github.com/dragon1672/go-keep-export-to-text/keep/output/text"
+	"github.com/dragon1672/go-keep-export-to-text/keep/stats"
+)
+
+const defaultCommand = "export"
+
+type command struct {
+	args  string
+	about string
+	run   func(cfg *config.Config, args []string) error
+}
+
+var commands = map[string]command{
+	"export":  {about: "run every configured writer over the takeout (default)", run: runExport},
+	"list":    {about: "list notes with their ids, dates and labels", run: runList},
+	"show":    {args: "<id|title>", about: "print a single note", run: runShow},
+	"stats":   {about: "print activity, label, checklist, length and color stats, see --stats_format", run: runStats},
+	"search":  {args: "<query>", about: "print notes containing the query in their title, content, list items or labels", run: runSearch},
+	"diff":    {args: "<old.zip> <new.zip>", about: "compare two takeouts, listing added, deleted, edited and relabelled notes with diffs, see --diff_format", run: runDiff},
+	"decrypt": {args: "<file|dir>...", about: "restore .age files from an encrypted export next to them, using --age_identity_file or --age_passphrase_env", run: runDecrypt},
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [command] [args] [flags]\n\nCommands:\n", os.Args[0])
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s %s\n    \t%s\n", name, commands[name].args, commands[name].about)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// collectNotes loads every filtered note sorted by creation date.
+func collectNotes(cfg *config.Config) ([]*loader.Note, error) {
+	var notes []*loader.Note
+	if err := export.StreamNotes(context.Background(), cfg, startTime, export.SourceHooks{OnReject: printReject}, func(n *loader.Note) error {
+		notes = append(notes, n)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].CreatedMicros.Time().Before(notes[j].CreatedMicros.Time())
+	})
+	return notes, nil
+}
+
+// printReject tells the user about an entry a lenient source skipped, commands without a run report print them to stderr.
+func printReject(r loader.Reject) {
+	fmt.Fprintf(os.Stderr, "skipped unreadable %s: %s\n", r.Entry, r.Error)
+}
+
+func labelNames(n *loader.Note) []string {
+	var names []string
+	for _, l := range n.Labels {
+		names = append(names, l.Name)
+	}
+	return names
+}
+
+func printNotes(notes []*loader.Note, dateLayout string) error {
+	for i, n := range notes {
+		txt, err := text.Note2Txt(n, dateLayout)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println("\n---")
+		}
+		fmt.Printf("[%s]\n%s\n", n.ID(), txt)
+	}
+	return nil
+}
+
+func runList(cfg *config.Config, _ []string) error {
+	notes, err := collectNotes(cfg)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	date := func(t *loader.MicroTime) string {
+		if t == nil {
+			return "-"
+		}
+		return t.Format(cfg.Output.DateLayout)
+	}
+	fmt.Fprintln(w, "ID\tCREATED\tEDITED\tTITLE\tLABELS")
+	for _, n := range notes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", n.ID(), date(n.CreatedMicros), date(n.EditedMicros), n.Title, strings.Join(labelNames(n), ","))
+	}
+	return w.Flush()
+}
+
+func runShow(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("show requires exactly 1 id or title, got %d", len(args))
+	}
+	want := args[0]
+	notes, err := collectNotes(cfg)
+	if err != nil {
+		return err
+	}
+	var matches []*loader.Note
+	for _, n := range notes {
+		if n.ID() == want || n.FileName == want || strings.EqualFold(n.Title, want) {
+			matches = append(matches, n)
+		}
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no note found matching %q", want)
+	}
+	return printNotes(matches, cfg.Output.DateLayout)
+}
+
+func runSearch(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("search requires a query")
+	}
+	query := strings.ToLower(strings.Join(args, " "))
+	notes, err := collectNotes(cfg)
+	if err != nil {
+		return err
+	}
+	var matches []*loader.Note
+	for _, n := range notes {
+		fields := append([]string{n.Title, n.TextContent}, labelNames(n)...)
+		for _, item := range n.ListContent {
+			fields = append(fields, item.Text)
+		}
+		for _, field := range fields {
+			if strings.Contains(strings.ToLower(field), query) {
+				matches = append(matches, n)
+				break
+			}
+		}
+	}
+	if len(matches) == 0 {
+		fmt.Printf("no notes matching %q\n", query)
+		return nil
+	}
+	return printNotes(matches, cfg.Output.DateLayout)
+}
+
+func runStats(cfg *config.Config, _ []string) error {
+	notes, err := collectNotes(cfg)
+	if err != nil {
+		return err
+	}
+	s := stats.Compute(notes, cfg.Source.DefaultTags...)
+	switch *StatsFormat {
+	case "json":
+		return s.PrintJSON(os.Stdout)
+	case "html":
+		return s.PrintHTML(os.Stdout)
+	case "table":
+		return s.PrintTable(os.Stdout)
+	}
+	return fmt.Errorf("unknown --stats_format %q", *StatsFormat)
+}
+
+// runDiff compares every note in two takeouts, ignoring the filters so notes moving to the trash show as changes.
+func runDiff(cfg *config.Config, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("diff requires an old and a new takeout, got %d", len(args))
+	}
+	ctx := context.Background()
+	var takeouts []map[string]*loader.Note
+	for _, path := range args {
+		c := *cfg
+		c.Source.ZipFilePath = path
+		c.Source.Merge = nil
+		c.Source.Dedup = "" // every note is matched by id
+		zipName := filepath.Base(path)
+		source, err := export.NewSource(&c, startTime, export.SourceHooks{OnReject: func(r loader.Reject) {
+			r.Entry = zipName + ":" + r.Entry
+			printReject(r)
+		}})
+		if err != nil {
+			return err
+		}
+		notes, err := diff.Load(ctx, source)
+		if err != nil {
+			return fmt.Errorf("error reading notes from zip file %s: %v", path, err)
+		}
+		takeouts = append(takeouts, notes)
+	}
+	result := diff.Compare(takeouts[0], takeouts[1])
+	switch *DiffFormat {
+	case "json":
+		return result.PrintJSON(os.Stdout)
+	case "text":
+		return result.PrintText(os.Stdout)
+	}
+	return fmt.Errorf("unknown --diff_format %q", *DiffFormat)
+}
+
+// runDecrypt restores every .age file given, or found under the given dirs, next to the encrypted file.
+func runDecrypt(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("decrypt requires at least 1 file or dir")
+	}
+	passphrase, err := export.EnvPassphrase(cfg.Output.Encryption.PassphraseEnv)
+	if err != nil {
+		return err
+	}
+	identities, err := keep.ParseIdentities(*AgeIdentityFile, passphrase)
+	if err != nil {
+		return err
+	}
+	var files []string
+	for _, arg := range args {
+		if err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(path, keep.EncryptedExt) {
+				files = append(files, path)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no %s files found in %s", keep.EncryptedExt, strings.Join(args, ", "))
+	}
+	for _, f := range files {
+		dest := keep.DecryptedPath(f)
+		if err := keep.DecryptFile(f, dest, identities...); err != nil {
+			return err
+		}
+		fmt.Println(dest)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package keep
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"path/filepath"
+
+	"filippo.io/age"
+)
+
+// archiveEpoch is used for entries without a note time so archives are reproducible.
+var archiveEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type archiveEntry struct {
+	data    []byte
+	modTime time.Time
+}
+
+// ArchiveSink collects every file in memory and writes them into a single zip or tar.gz on Close.
+// Entries are sorted by name and timestamped from their notes so the same notes produce the same archive.
+type ArchiveSink struct {
+	Path      string // .zip, .tar.gz or .tgz
+	Overwrite string // policy for entries written more than once, only fail and skip-existing differ from overwrite
+	// Recipients optionally encrypts the whole archive with age, it is written to `${Path}.age`.
+	Recipients []age.Recipient
+
+	mu      sync.Mutex
+	base    string // entries are named relative to the working dir
+	entries map[string]archiveEntry
+}
+
+// NewArchiveSink checks path has a supported extension and prepares a sink for it.
+func NewArchiveSink(path string, overwrite string) (*ArchiveSink, error) {
+	if !isZip(path) && !isTarGz(path) {
+		return nil, fmt.Errorf("unsupported archive %s, expected .zip, .tar.gz or .tgz", path)
+	}
+	base, err := filepath.Abs(".")
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveSink{Path: path, Overwrite: overwrite, base: base, entries: make(map[string]archiveEntry)}, nil
+}
+
+func isZip(path string) bool { return strings.HasSuffix(path, ".zip") }
+func isTarGz(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// entryName converts a destination path into a slash separated path inside the archive.
+func (a *ArchiveSink) entryName(destination string) string {
+	abs, err := filepath.Abs(destination)
+	if err != nil {
+		abs = destination
+	}
+	if rel, err := filepath.Rel(a.base, abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	// outside the working dir, keep the full path minus the root
+	return strings.TrimLeft(filepath.ToSlash(strings.TrimPrefix(abs, filepath.VolumeName(abs))), "/")
+}
+
+func (a *ArchiveSink) Write(destination string, data []byte, modTime time.Time) (string, error) {
+	name := a.entryName(destination)
+	if modTime.IsZero() {
+		modTime = archiveEpoch
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.entries[name]; ok {
+		switch a.Overwrite {
+		case OverwriteSkipExisting:
+			return "", nil
+		case OverwriteFail:
+			return "", fmt.Errorf("refusing to overwrite existing archive entry %s", name)
+		}
+	}
+	a.entries[name] = archiveEntry{data: data, modTime: modTime}
+	return destination, nil
+}
+
+func (a *ArchiveSink) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var names []string
+	for name := range a.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	path := a.Path
+	if len(a.Recipients) > 0 {
+		path += EncryptedExt
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	write := a.writeZip
+	if isTarGz(a.Path) {
+		write = a.writeTarGz
+	}
+	var out io.WriteCloser = nopCloser{tmp}
+	if len(a.Recipients) > 0 {
+		if out, err = age.Encrypt(tmp, a.Recipients...); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := write(out, names); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func (a *ArchiveSink) writeZip(w io.Writer, names []string) error {
+	zw := zip.NewWriter(w)
+	for _, name := range names {
+		entry := a.entries[name]
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: entry.modTime.UTC(),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(entry.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func (a *ArchiveSink) writeTarGz(w io.Writer, names []string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, name := range names {
+		entry := a.entries[name]
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(entry.data)),
+			ModTime: entry.modTime.UTC(),
+			Format:  tar.FormatPAX,
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entry.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
@@ -0,0 +1,332 @@
+// Package config describes an export run as a JSON file so it doesn't have to be spelled out in flags every time.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"path/filepath"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep/transform"
+)
+
+// Writer types understood by the CLI.
+const (
+	WriterConsole  = "console"
+	WriterText     = "text"
+	WriterMarkdown = "markdown"
+	WriterOPML     = "opml"
+	WriterPDF      = "pdf"
+	WriterGit      = "git"
+)
+
+// Config is the full description of an export run.
+type Config struct {
+	Source  Source   `json:"source"`
+	Filters Filters  `json:"filters"`
+	Output  Output   `json:"output"`
+	Writers []Writer `json:"writers"`
+	// Transforms clean up notes after filtering, in order, so every writer sees the same notes.
+	Transforms []Transform `json:"transforms,omitempty"`
+
+	// Profiles are partial configs layered over the base config when selected, eg: `obsidian` or `notebooklm`.
+	// Any field present in the profile replaces the base value, lists (like writers) are replaced entirely.
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
+}
+
+// Source controls where notes are read from.
+type Source struct {
+	ZipFilePath   string   `json:"zip_file_path"`
+	SubFolderPath string   `json:"sub_folder_path"`
+	DefaultTags   []string `json:"default_tags"`
+	Lenient       bool     `json:"lenient"`        // skip unreadable notes instead of failing
+	QuarantineDir string   `json:"quarantine_dir"` // optionally copy unreadable notes here
+
+	// zip bomb protection, 0 is unlimited
+	MaxEntries          int     `json:"max_entries"`
+	MaxEntrySize        int64   `json:"max_entry_size"`
+	MaxTotalSize        int64   `json:"max_total_size"`
+	MaxCompressionRatio float64 `json:"max_compression_ratio"`
+
+	ParseWorkers int  `json:"parse_workers"` // notes parsed in parallel, 1 or less is serial
+	Ordered      bool `json:"ordered"`       // keep zip order when parsing in parallel
+
+	LabelMapFile string `json:"label_map_file"` // optional JSON label map applied before filtering
+
+	Dedup          string  `json:"dedup"`           // off, report, skip or merge-labels
+	DedupThreshold float64 `json:"dedup_threshold"` // similarity for near duplicates, 1 only finds exact duplicates
+
+	// Merge reads several takeouts, eg: from different accounts or dates, instead of zip_file_path.
+	// Notes in more than one keep their most recently edited version.
+	Merge      []MergeSource `json:"merge,omitempty"`
+	TagAccount bool          `json:"tag_account"` // label merged notes with the account they came from
+}
+
+// MergeSource is one of the takeouts being merged.
+type MergeSource struct {
+	Path    string `json:"path"`
+	Account string `json:"account,omitempty"` // defaults to the zip file name without .zip
+}
+
+// AccountName is the configured account or one derived from the zip file name.
+func (m MergeSource) AccountName() string {
+	if m.Account != "" {
+		return m.Account
+	}
+	return strings.TrimSuffix(filepath.Base(m.Path), filepath.Ext(m.Path))
+}
+
+// Filters controls which notes are exported.
+type Filters struct {
+	DateMin string `json:"date_min"` // inclusive YYYY-MM-DD
+	DateMax string `json:"date_max"` // inclusive YYYY-MM-DD
+
+	EditedMin      string `json:"edited_min"`       // inclusive YYYY-MM-DD, notes never edited use their created time
+	EditedMax      string `json:"edited_max"`       // inclusive YYYY-MM-DD
+	Since          string `json:"since"`            // created since YYYY-MM-DD or a relative amount such as 90d
+	EditedSince    string `json:"edited_since"`     // like since, or last-export to read last_export_file
+	LastExportFile string `json:"last_export_file"` // where the last export time is kept
+
+	IncludeLabels []string `json:"include_labels"` // notes need at least one, ignoring case
+	ExcludeLabels []string `json:"exclude_labels"` // notes with any are skipped
+	UnlabeledOnly bool     `json:"unlabeled_only"` // default tags don't count as labels
+
+	IncludeArchived bool `json:"include_archived"`
+	IncludeTrashed  bool `json:"include_trashed"`
+}
+
+// Output holds settings shared by every writer.
+type Output struct {
+	FileNameStrat      string `json:"file_name_strat"`
+	CreateYearFolders  bool   `json:"create_year_folders"`
+	CreateMonthFolders bool   `json:"create_month_folders"`
+	CreateOut          bool   `json:"create_out"`
+	Overwrite          string `json:"overwrite"` // policy for existing files: overwrite, skip-existing, fail, backup or suffix
+	Archive            string `json:"archive"`   // optional .zip or .tar.gz to put every writer's files in instead of the filesystem
+	PreserveModTime    bool   `json:"preserve_mod_time"`
+	Timezone           string `json:"timezone"`         // IANA zone for dates and date filters, defaults to the local zone
+	DateLayout         string `json:"date_layout"`      // Go time layout for dates rendered in notes, or rfc3339
+	FileDateLayout     string `json:"file_date_layout"` // Go time layout for dates in file names, or rfc3339
+	StateRouting       string `json:"state_routing"`    // default for writers: split, tag or none
+
+	Incremental        bool   `json:"incremental"`         // only write files that changed since the previous run, see keep.Manifest
+	IncrementalRemoved string `json:"incremental_removed"` // outputs of notes missing from this run: keep, delete or quarantine
+	Parallelism        int    `json:"parallelism"`         // max note writes in flight, defaults to the number of CPUs
+	KeepGoing          bool   `json:"keep_going"`          // record failed writes in the report and carry on
+	ReportFormat       string `json:"report_format"`       // run report printed to stderr: table, json or none
+
+	Encryption Encryption `json:"encryption"`
+}
+
+// Encryption encrypts every output file, or the whole archive, with age.
+// Use either recipient public keys or a passphrase, the passphrase itself is never stored in the config.
+type Encryption struct {
+	Recipients     []string `json:"recipients,omitempty"`      // age1... public keys
+	RecipientsFile string   `json:"recipients_file,omitempty"` // one public key per line
+	PassphraseEnv  string   `json:"passphrase_env,omitempty"`  // environment variable holding the passphrase
+}
+
+// Enabled reports if any encryption is configured.
+func (e Encryption) Enabled() bool {
+	return len(e.Recipients) > 0 || e.RecipientsFile != "" || e.PassphraseEnv != ""
+}
+
+// Writer is a single writer instance, the same type can be listed multiple times.
+type Writer struct {
+	Type       string `json:"type"`
+	OutDir     string `json:"out_dir,omitempty"`     // text, markdown, pdf and git (the repo)
+	OutputFile string `json:"output_file,omitempty"` // opml
+	WordLimit  int    `json:"word_limit,omitempty"`  // pdf, defaults to 500,000
+	Format     string `json:"format,omitempty"`      // git: markdown or text
+	Author     string `json:"author,omitempty"`      // git: `Name <email>` commits are signed with
+	// StateRouting is how archived and trashed notes are written: split, tag or none, defaults to output.state_routing.
+	StateRouting string `json:"state_routing,omitempty"`
+}
+
+// Routing is the writer's state routing, falling back to the output default.
+func (c *Config) Routing(w Writer) string {
+	if w.StateRouting != "" {
+		return w.StateRouting
+	}
+	return c.Output.StateRouting
+}
+
+// Transform is a single note transformer, see keep/transform for the types.
+type Transform struct {
+	Type      string                   `json:"type"`
+	Max       int                      `json:"max,omitempty"`        // collapse_blank_lines: blank lines to keep, title_from_first_line: title length
+	Rules     []transform.LabelRule    `json:"rules,omitempty"`      // label_rules
+	RulesFile string                   `json:"rules_file,omitempty"` // label_rules, a JSON list of rules added after Rules
+	Redact    *transform.RedactOptions `json:"redact,omitempty"`     // redact, defaults to every built in detector
+}
+
+// Load reads a config from path, layering the named profile on top if one is provided.
+func Load(path string, profile string, base *Config) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := base
+	if c == nil {
+		c = &Config{}
+	}
+	if err := c.layer(data); err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %v", path, err)
+	}
+	if err := c.ApplyProfile(profile); err != nil {
+		return nil, fmt.Errorf("error applying profile from %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// ApplyProfile layers the named profile over the current config. An empty name is a no-op.
+func (c *Config) ApplyProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	raw, ok := c.Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q, options are %v", name, c.ProfileNames())
+	}
+	return c.layer(raw)
+}
+
+// layer decodes data over the config. Lists of objects present in data replace the current ones,
+// json.Unmarshal would otherwise decode each element over the existing one keeping any field data leaves out.
+func (c *Config) layer(data []byte) error {
+	var lists struct {
+		Source struct {
+			Merge json.RawMessage `json:"merge"`
+		} `json:"source"`
+		Writers    json.RawMessage `json:"writers"`
+		Transforms json.RawMessage `json:"transforms"`
+	}
+	if err := json.Unmarshal(data, &lists); err != nil {
+		return err
+	}
+	if lists.Source.Merge != nil {
+		c.Source.Merge = nil
+	}
+	if lists.Writers != nil {
+		c.Writers = nil
+	}
+	if lists.Transforms != nil {
+		c.Transforms = nil
+	}
+	return json.Unmarshal(data, c)
+}
+
+// ProfileNames lists the available profiles in sorted order.
+func (c *Config) ProfileNames() []string {
+	var names []string
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetWriter replaces all writers of the given type with w, or removes them if w is nil.
+func (c *Config) SetWriter(writerType string, w *Writer) {
+	var ws []Writer
+	for _, existing := range c.Writers {
+		if existing.Type != writerType {
+			ws = append(ws, existing)
+		}
+	}
+	if w != nil {
+		w.Type = writerType
+		ws = append(ws, *w)
+	}
+	c.Writers = ws
+}
+
+// Location loads the configured time zone.
+func (c *Config) Location() (*time.Location, error) {
+	if c.Output.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(c.Output.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("error loading timezone %q: %v", c.Output.Timezone, err)
+	}
+	return loc, nil
+}
+
+// Validate checks the time zone loads and the writers are all known types with the fields they need.
+func (c *Config) Validate() error {
+	if _, err := c.Location(); err != nil {
+		return err
+	}
+	for i, m := range c.Source.Merge {
+		if m.Path == "" {
+			return fmt.Errorf("merge source %d requires a path", i)
+		}
+	}
+	switch c.Source.Dedup {
+	case "", "off", "report", "skip", "merge-labels":
+	default:
+		return fmt.Errorf("unknown dedup mode %q, expected off, report, skip or merge-labels", c.Source.Dedup)
+	}
+	if c.Source.DedupThreshold < 0 || c.Source.DedupThreshold > 1 {
+		return fmt.Errorf("dedup threshold %v should be between 0 and 1", c.Source.DedupThreshold)
+	}
+	switch c.Output.Overwrite {
+	case "", "overwrite", "skip-existing", "fail", "backup", "suffix":
+	default:
+		return fmt.Errorf("unknown overwrite %q, expected overwrite, skip-existing, fail, backup or suffix", c.Output.Overwrite)
+	}
+	switch c.Output.IncrementalRemoved {
+	case "", "keep", "delete", "quarantine":
+	default:
+		return fmt.Errorf("unknown incremental_removed %q, expected keep, delete or quarantine", c.Output.IncrementalRemoved)
+	}
+	switch c.Output.ReportFormat {
+	case "", "table", "json", "none":
+	default:
+		return fmt.Errorf("unknown report_format %q, expected table, json or none", c.Output.ReportFormat)
+	}
+	if c.Output.Parallelism < 0 {
+		return fmt.Errorf("parallelism %d can't be negative", c.Output.Parallelism)
+	}
+	if c.Output.Incremental && c.Output.Archive != "" {
+		return fmt.Errorf("incremental exports can't be used with an output archive")
+	}
+	for i, w := range c.Writers {
+		switch w.Type {
+		case WriterConsole:
+		case WriterText, WriterMarkdown, WriterPDF:
+			if w.OutDir == "" {
+				return fmt.Errorf("writer %d (%s) requires out_dir", i, w.Type)
+			}
+		case WriterGit:
+			if w.OutDir == "" {
+				return fmt.Errorf("writer %d (%s) requires out_dir", i, w.Type)
+			}
+			if c.Output.Archive != "" || c.Output.Encryption.Enabled() {
+				return fmt.Errorf("writer %d (%s) commits straight to its repo, it can't be combined with an archive or encryption", i, w.Type)
+			}
+			switch w.Format {
+			case "", "markdown", "text":
+			default:
+				return fmt.Errorf("writer %d (%s) has unknown format %q, expected markdown or text", i, w.Type, w.Format)
+			}
+		case WriterOPML:
+			if w.OutputFile == "" {
+				return fmt.Errorf("writer %d (%s) requires output_file", i, w.Type)
+			}
+		default:
+			return fmt.Errorf("writer %d has unknown type %q", i, w.Type)
+		}
+		switch r := c.Routing(w); r {
+		case "", "split", "tag", "none":
+		default:
+			return fmt.Errorf("writer %d (%s) has unknown state routing %q, expected split, tag or none", i, w.Type, r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+// Package dedup finds duplicate and near duplicate notes, by normalized content hash and MinHash similarity.
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/fnv"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+)
+
+// What to do with duplicates.
+const (
+	ModeReport      = "report"       // export every note, only report duplicates
+	ModeSkip        = "skip"         // only export the newest note of each group
+	ModeMergeLabels = "merge-labels" // only export the newest note of each group, with the labels of all of them
+)
+
+// SkipReason is passed to OnSkip for every dropped duplicate.
+const SkipReason = "duplicate"
+
+const (
+	shingleSize = 3   // words per shingle
+	numHashes   = 128 // MinHash signature length
+)
+
+// NoteRef identifies a note in a duplicate group.
+type NoteRef struct {
+	ID       string `json:"id"`
+	FileName string `json:"file_name"`
+	Title    string `json:"title"`
+}
+
+func ref(n *loader.Note) NoteRef {
+	return NoteRef{ID: n.ID(), FileName: n.FileName, Title: n.Title}
+}
+
+// Group is a set of notes with the same or similar content.
+type Group struct {
+	Kept       NoteRef   `json:"kept"` // the newest note
+	Duplicates []NoteRef `json:"duplicates"`
+	Exact      bool      `json:"exact"`      // every note has the same normalized content
+	Similarity float64   `json:"similarity"` // lowest similarity between the kept note and a duplicate, at least the threshold
+}
+
+// Source wraps another source, holding back every note until duplicates are found.
+// Notes are passed on in their original order, minus any dropped duplicates.
+type Source struct {
+	Source    loader.NoteSource
+	Mode      string  // defaults to ModeReport
+	Threshold float64 // word shingle Jaccard similarity for near duplicates, 0 or 1 and above only finds exact duplicates
+	// Filter optionally limits which notes are compared, others are passed on untouched.
+	// Use the export filters so a trashed copy can't win over the note that is actually exported.
+	Filter loader.Filter
+	// OnGroup is optionally called with every group found, before any note is passed on.
+	OnGroup func(Group)
+	// OnSkip is optionally called with every duplicate dropped by ModeSkip or ModeMergeLabels.
+	OnSkip func(n *loader.Note, reason string)
+}
+
+type entry struct {
+	note     *loader.Note
+	hash     [sha256.Size]byte
+	shingles map[uint64]bool
+	sig      []uint64
+}
+
+func (s *Source) StreamNotes(ctx context.Context, fun func(*loader.Note) error) error {
+	var notes []*loader.Note
+	if err := s.Source.StreamNotes(ctx, func(n *loader.Note) error {
+		notes = append(notes, n)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var entries []*entry
+	for _, n := range notes {
+		if s.Filter != nil && !s.Filter(n) {
+			continue
+		}
+		words := normalizedWords(n)
+		if len(words) == 0 {
+			continue // nothing to compare
+		}
+		e := &entry{note: n, hash: sha256.Sum256([]byte(strings.Join(words, " "))), shingles: shingles(words)}
+		if s.Threshold > 0 && s.Threshold < 1 {
+			e.sig = signature(e.shingles)
+		}
+		entries = append(entries, e)
+	}
+
+	dropped := make(map[*loader.Note]bool)
+	for _, g := range s.groups(entries) {
+		kept, group := s.resolve(g)
+		if s.OnGroup != nil {
+			s.OnGroup(group)
+		}
+		if s.Mode != ModeSkip && s.Mode != ModeMergeLabels {
+			continue
+		}
+		for _, e := range g {
+			if e.note != kept {
+				dropped[e.note] = true
+			}
+		}
+	}
+
+	for _, n := range notes {
+		if dropped[n] {
+			if s.OnSkip != nil {
+				s.OnSkip(n, SkipReason)
+			}
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fun(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve keeps the first, newest, note of the group, merging labels into it if configured.
+func (s *Source) resolve(g []*entry) (*loader.Note, Group) {
+	kept := g[0]
+	group := Group{Kept: ref(kept.note), Exact: true, Similarity: 1}
+	for _, e := range g[1:] {
+		group.Duplicates = append(group.Duplicates, ref(e.note))
+		if e.hash != kept.hash {
+			group.Exact = false
+			if sim := jaccard(kept.shingles, e.shingles); sim < group.Similarity {
+				group.Similarity = sim
+			}
+		}
+	}
+	if s.Mode == ModeMergeLabels {
+		for _, e := range g[1:] {
+			for _, l := range e.note.Labels {
+				if !kept.note.HasLabel(l.Name) {
+					kept.note.Labels = append(kept.note.Labels, l)
+				}
+			}
+		}
+	}
+	return kept.note, group
+}
+
+// groups joins entries with the same hash, or similar shingles, into groups of 2 or more ordered newest first.
+// Similarity isn't transitive, so every note in a group is the same as or similar to its newest note.
+func (s *Source) groups(entries []*entry) [][]*entry {
+	parent := make([]int, len(entries))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(i, j int) { parent[find(i)] = find(j) }
+
+	byHash := make(map[[sha256.Size]byte]int)
+	for i, e := range entries {
+		if j, ok := byHash[e.hash]; ok {
+			union(i, j)
+			continue
+		}
+		byHash[e.hash] = i
+	}
+
+	if s.Threshold > 0 && s.Threshold < 1 {
+		// locality sensitive hashing, only notes sharing a band of their signature are compared
+		bandRows := rowsPerBand(s.Threshold)
+		checked := make(map[[2]int]bool)
+		for band := 0; band < numHashes/bandRows; band++ {
+			buckets := make(map[string][]int)
+			for i, e := range entries {
+				key := make([]byte, 8*bandRows)
+				for r := 0; r < bandRows; r++ {
+					binary.LittleEndian.PutUint64(key[8*r:], e.sig[band*bandRows+r])
+				}
+				buckets[string(key)] = append(buckets[string(key)], i)
+			}
+			for _, bucket := range buckets {
+				for a := 0; a < len(bucket); a++ {
+					for b := a + 1; b < len(bucket); b++ {
+						i, j := bucket[a], bucket[b]
+						if checked[[2]int{i, j}] || find(i) == find(j) {
+							continue
+						}
+						checked[[2]int{i, j}] = true
+						if jaccard(entries[i].shingles, entries[j].shingles) >= s.Threshold {
+							union(i, j)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	byRoot := make(map[int][]*entry)
+	var roots []int
+	for i, e := range entries {
+		root := find(i)
+		if _, ok := byRoot[root]; !ok {
+			roots = append(roots, root)
+		}
+		byRoot[root] = append(byRoot[root], e)
+	}
+	var groups [][]*entry
+	for _, root := range roots {
+		if len(byRoot[root]) > 1 {
+			groups = append(groups, s.split(byRoot[root])...)
+		}
+	}
+	return groups
+}
+
+// split breaks a chain of similar notes, eg: A~B and B~C but not A~C, into groups around their newest note.
+// The newest note left takes every note left that's the same or similar to it, until none are left.
+func (s *Source) split(chain []*entry) [][]*entry {
+	sort.SliceStable(chain, func(i, j int) bool {
+		return chain[i].note.EditedTime().After(chain[j].note.EditedTime())
+	})
+	var groups [][]*entry
+	for len(chain) > 1 {
+		kept := chain[0]
+		group := []*entry{kept}
+		var rest []*entry
+		for _, e := range chain[1:] {
+			if e.hash == kept.hash || (e.sig != nil && jaccard(kept.shingles, e.shingles) >= s.Threshold) {
+				group = append(group, e)
+			} else {
+				rest = append(rest, e)
+			}
+		}
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+		chain = rest
+	}
+	return groups
+}
+
+// rowsPerBand picks the widest LSH bands that still make notes at the threshold candidates 99% of the time.
+// Wider bands mean fewer dissimilar notes are compared, which matters when many notes share boilerplate.
+func rowsPerBand(threshold float64) int {
+	for rows := numHashes / 8; rows > 1; rows /= 2 {
+		if 1-math.Pow(1-math.Pow(threshold, float64(rows)), float64(numHashes/rows)) >= 0.99 {
+			return rows
+		}
+	}
+	return 1
+}
+
+// normalizedWords is the lower cased words of the title, body and list items, ignoring checked state and punctuation.
+func normalizedWords(n *loader.Note) []string {
+	parts := []string{n.ExtractedTitle, n.TextContent} // not Title, untitled notes fall back to their unique file name
+	for _, item := range n.ListContent {
+		parts = append(parts, item.Text)
+	}
+	return strings.FieldsFunc(strings.ToLower(strings.Join(parts, "\n")), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// shingles hashes every run of shingleSize words, short notes use all their words as a single shingle.
+func shingles(words []string) map[uint64]bool {
+	set := make(map[uint64]bool)
+	size := shingleSize
+	if len(words) < size {
+		size = len(words)
+	}
+	for i := 0; i+size <= len(words); i++ {
+		h := fnv.New64a()
+		fmt.Fprint(h, strings.Join(words[i:i+size], " "))
+		set[h.Sum64()] = true
+	}
+	return set
+}
+
+// seeds are fixed so signatures, and the groups found, are the same every run.
+var seeds = func() []uint64 {
+	s := make([]uint64, numHashes)
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range s {
+		x = mix(x + uint64(i))
+		s[i] = x
+	}
+	return s
+}()
+
+// mix is the splitmix64 finalizer.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// signature is the MinHash of the shingles, notes with similar shingles have similar signatures.
+func signature(shingles map[uint64]bool) []uint64 {
+	sig := make([]uint64, numHashes)
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+	for sh := range shingles {
+		for i, seed := range seeds {
+			if h := mix(sh ^ seed); h < sig[i] {
+				sig[i] = h
+			}
+		}
+	}
+	return sig
+}
+
+func jaccard(a, b map[uint64]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for sh := range a {
+		if b[sh] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+var _ loader.NoteSource = (*Source)(nil)
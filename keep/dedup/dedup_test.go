@@ -0,0 +1,225 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+)
+
+// notes is a source streaming a fixed list of notes.
+type notes []*loader.Note
+
+func (ns notes) StreamNotes(_ context.Context, fun func(*loader.Note) error) error {
+	for _, n := range ns {
+		if err := fun(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var base = time.Date(2021, time.June, 17, 0, 0, 0, 0, time.UTC)
+
+// note makes a note edited the given number of days after base, later days are newer.
+func note(name, text string, day int) *loader.Note {
+	created := loader.MicroTime(base)
+	edited := loader.MicroTime(base.AddDate(0, 0, day))
+	return &loader.Note{FileName: name, Title: name, TextContent: text, CreatedMicros: &created, EditedMicros: &edited}
+}
+
+// words is w{from} to w{to-1} joined by spaces.
+func words(from, to int) string {
+	var ws []string
+	for i := from; i < to; i++ {
+		ws = append(ws, fmt.Sprintf("w%d", i))
+	}
+	return strings.Join(ws, " ")
+}
+
+// run dedups ns, returning the names of the notes passed on and the groups found.
+func run(t *testing.T, s *Source, ns ...*loader.Note) ([]string, []Group) {
+	t.Helper()
+	s.Source = notes(ns)
+	var groups []Group
+	s.OnGroup = func(g Group) { groups = append(groups, g) }
+	var kept []string
+	if err := s.StreamNotes(context.Background(), func(n *loader.Note) error {
+		kept = append(kept, n.FileName)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return kept, groups
+}
+
+func TestExactDuplicates(t *testing.T) {
+	kept, groups := run(t, &Source{Mode: ModeSkip},
+		note("old", "Milk, eggs & bread", 1),
+		note("other", "something else entirely", 2),
+		note("new", "milk eggs bread", 3),
+	)
+	if got, want := strings.Join(kept, ","), "other,new"; got != want {
+		t.Errorf("kept %s, want %s", got, want)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups, want 1", len(groups))
+	}
+	g := groups[0]
+	if g.Kept.FileName != "new" || len(g.Duplicates) != 1 || g.Duplicates[0].FileName != "old" {
+		t.Errorf("got group %+v, want new keeping old", g)
+	}
+	if !g.Exact || g.Similarity != 1 {
+		t.Errorf("got exact %v similarity %v, want an exact match", g.Exact, g.Similarity)
+	}
+}
+
+func TestExactIgnoresCheckedState(t *testing.T) {
+	a, b := note("a", "", 1), note("b", "", 2)
+	a.ListContent = []loader.ListItem{{Text: "milk", IsChecked: true}, {Text: "eggs"}}
+	b.ListContent = []loader.ListItem{{Text: "Milk"}, {Text: "eggs", IsChecked: true}}
+	kept, groups := run(t, &Source{Mode: ModeSkip}, a, b)
+	if got, want := strings.Join(kept, ","), "b"; got != want {
+		t.Errorf("kept %s, want %s", got, want)
+	}
+	if len(groups) != 1 || !groups[0].Exact {
+		t.Errorf("got groups %+v, want 1 exact group", groups)
+	}
+}
+
+func TestNearDuplicates(t *testing.T) {
+	kept, groups := run(t, &Source{Mode: ModeSkip, Threshold: 0.8},
+		note("draft", words(0, 40), 1),
+		note("final", words(0, 40)+" extra", 2),
+		note("unrelated", words(100, 140), 3),
+	)
+	if got, want := strings.Join(kept, ","), "final,unrelated"; got != want {
+		t.Errorf("kept %s, want %s", got, want)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups, want 1", len(groups))
+	}
+	if g := groups[0]; g.Exact || g.Similarity < 0.8 || g.Similarity >= 1 {
+		t.Errorf("got exact %v similarity %v, want a near match of at least 0.8", g.Exact, g.Similarity)
+	}
+}
+
+func TestNearDuplicatesNeedThreshold(t *testing.T) {
+	// without a threshold only exact duplicates are found
+	kept, groups := run(t, &Source{Mode: ModeSkip},
+		note("draft", words(0, 40), 1),
+		note("final", words(0, 40)+" extra", 2),
+	)
+	if len(kept) != 2 || len(groups) != 0 {
+		t.Errorf("kept %v with groups %+v, want both notes and no groups", kept, groups)
+	}
+}
+
+func TestChainedNotesAreGroupedAroundTheKeptNote(t *testing.T) {
+	// a~b and b~c are over the threshold but a and c only share 2 of 14 shingles
+	a, b, c := note("a", words(0, 10), 3), note("b", words(3, 13), 2), note("c", words(6, 16), 1)
+	kept, groups := run(t, &Source{Mode: ModeSkip, Threshold: 0.4}, a, b, c)
+	if got, want := strings.Join(kept, ","), "a,c"; got != want {
+		t.Errorf("kept %s, want %s", got, want)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups, want 1", len(groups))
+	}
+	g := groups[0]
+	if g.Kept.FileName != "a" || len(g.Duplicates) != 1 || g.Duplicates[0].FileName != "b" {
+		t.Errorf("got group %+v, want a keeping b", g)
+	}
+	if g.Similarity < 0.4 {
+		t.Errorf("got similarity %v, want at least the threshold", g.Similarity)
+	}
+}
+
+func TestChainSplitsIntoSeveralGroups(t *testing.T) {
+	// the newest note takes b, then c is the newest left and takes d
+	kept, groups := run(t, &Source{Mode: ModeSkip, Threshold: 0.4},
+		note("a", words(0, 10), 4),
+		note("b", words(3, 13), 3),
+		note("c", words(6, 16), 2),
+		note("d", words(9, 19), 1),
+	)
+	if got, want := strings.Join(kept, ","), "a,c"; got != want {
+		t.Errorf("kept %s, want %s", got, want)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2", len(groups))
+	}
+}
+
+func TestReportKeepsEveryNote(t *testing.T) {
+	kept, groups := run(t, &Source{Mode: ModeReport},
+		note("a", "same words", 1),
+		note("b", "same words", 2),
+	)
+	if len(kept) != 2 || len(groups) != 1 {
+		t.Errorf("kept %v with %d groups, want both notes and 1 group", kept, len(groups))
+	}
+}
+
+func TestMergeLabels(t *testing.T) {
+	older, newer := note("old", "same words", 1), note("new", "same words", 2)
+	older.Labels = []loader.ListLabel{{Name: "shopping"}, {Name: "home"}}
+	newer.Labels = []loader.ListLabel{{Name: "home"}}
+	var skipped []string
+	s := &Source{Mode: ModeMergeLabels, OnSkip: func(n *loader.Note, reason string) {
+		skipped = append(skipped, n.FileName+":"+reason)
+	}}
+	kept, _ := run(t, s, older, newer)
+	if got, want := strings.Join(kept, ","), "new"; got != want {
+		t.Errorf("kept %s, want %s", got, want)
+	}
+	if !newer.HasLabel("shopping") || len(newer.Labels) != 2 {
+		t.Errorf("got labels %v, want home and shopping", newer.Labels)
+	}
+	if got, want := strings.Join(skipped, ","), "old:"+SkipReason; got != want {
+		t.Errorf("skipped %s, want %s", got, want)
+	}
+}
+
+func TestFilteredNotesAreNotCompared(t *testing.T) {
+	trashed := note("trashed", "same words", 2)
+	trashed.IsTrashed = true
+	kept, groups := run(t, &Source{Mode: ModeSkip, Filter: func(n *loader.Note) bool { return !n.IsTrashed }},
+		note("active", "same words", 1),
+		trashed,
+	)
+	if len(kept) != 2 || len(groups) != 0 {
+		t.Errorf("kept %v with groups %+v, want both notes and no groups", kept, groups)
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want float64
+	}{
+		{"w0 w1 w2 w3", "w0 w1 w2 w3", 1},
+		{"w0 w1 w2 w3", "w1 w2 w3 w4", 1.0 / 3},
+		{"w0 w1 w2", "w3 w4 w5", 0},
+		{"one", "one", 1}, // shorter than a shingle
+	} {
+		got := jaccard(shingles(strings.Fields(tc.a)), shingles(strings.Fields(tc.b)))
+		if got != tc.want {
+			t.Errorf("jaccard(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestRowsPerBand(t *testing.T) {
+	for _, threshold := range []float64{0.3, 0.5, 0.8, 0.9, 0.99} {
+		rows := rowsPerBand(threshold)
+		if numHashes%rows != 0 {
+			t.Errorf("rowsPerBand(%v) = %d doesn't divide %d hashes", threshold, rows, numHashes)
+		}
+	}
+	if rowsPerBand(0.9) < rowsPerBand(0.5) {
+		t.Errorf("higher thresholds should use wider bands, got %d for 0.9 and %d for 0.5", rowsPerBand(0.9), rowsPerBand(0.5))
+	}
+}
@@ -0,0 +1,235 @@
+// Package diff compares two takeouts, matching notes by their stable ID (file name plus created time).
+package diff
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"encoding/json"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+)
+
+// NoteRef identifies a note in either takeout.
+type NoteRef struct {
+	ID       string `json:"id"`
+	FileName string `json:"file_name"`
+	Title    string `json:"title"`
+}
+
+func ref(n *loader.Note) NoteRef {
+	return NoteRef{ID: n.ID(), FileName: n.FileName, Title: n.Title}
+}
+
+// Checklist item changes.
+const (
+	ItemAdded     = "added"
+	ItemRemoved   = "removed"
+	ItemChecked   = "checked"
+	ItemUnchecked = "unchecked"
+)
+
+// ItemChange is a checklist item added, removed, checked or unchecked, items are matched by their text.
+type ItemChange struct {
+	Change string `json:"change"`
+	Text   string `json:"text"`
+}
+
+// Change is a note found in both takeouts that differs, it can be edited, relabelled or both.
+type Change struct {
+	NoteRef
+	Edited        bool         `json:"edited"` // title, body or checklist changed
+	OldTitle      string       `json:"old_title,omitempty"`
+	BodyDiff      string       `json:"body_diff,omitempty"` // unified diff
+	Items         []ItemChange `json:"items,omitempty"`
+	LabelsAdded   []string     `json:"labels_added,omitempty"`
+	LabelsRemoved []string     `json:"labels_removed,omitempty"`
+	OldState      string       `json:"old_state,omitempty"` // active, archived or trashed, set when it moved
+	NewState      string       `json:"new_state,omitempty"`
+}
+
+// LabelsChanged reports if labels were added or removed.
+func (c *Change) LabelsChanged() bool {
+	return len(c.LabelsAdded) > 0 || len(c.LabelsRemoved) > 0
+}
+
+// Result is everything that changed between two takeouts, each list is sorted by file name.
+type Result struct {
+	Added     []NoteRef `json:"added"`
+	Deleted   []NoteRef `json:"deleted"`
+	Changed   []Change  `json:"changed"`
+	Unchanged int       `json:"unchanged"`
+}
+
+// Empty reports if the takeouts hold the same notes.
+func (r *Result) Empty() bool {
+	return len(r.Added) == 0 && len(r.Deleted) == 0 && len(r.Changed) == 0
+}
+
+// Load reads every note from a source keyed by ID.
+// Notes with the same ID (the same file name and created time) are reported as an error since they can't be told apart.
+func Load(ctx context.Context, source loader.NoteSource) (map[string]*loader.Note, error) {
+	notes := make(map[string]*loader.Note)
+	err := source.StreamNotes(ctx, func(n *loader.Note) error {
+		if other, ok := notes[n.ID()]; ok {
+			return fmt.Errorf("notes %s and %s have the same id %s", other.FileName, n.FileName, n.ID())
+		}
+		notes[n.ID()] = n
+		return nil
+	})
+	return notes, err
+}
+
+// Compare finds the notes added, deleted and changed going from the before takeout to the after one.
+func Compare(before, after map[string]*loader.Note) *Result {
+	r := &Result{}
+	for id, n := range after {
+		o, ok := before[id]
+		if !ok {
+			r.Added = append(r.Added, ref(n))
+			continue
+		}
+		if c, changed := compareNote(o, n); changed {
+			r.Changed = append(r.Changed, c)
+		} else {
+			r.Unchanged++
+		}
+	}
+	for id, o := range before {
+		if _, ok := after[id]; !ok {
+			r.Deleted = append(r.Deleted, ref(o))
+		}
+	}
+	sortRefs(r.Added)
+	sortRefs(r.Deleted)
+	sort.Slice(r.Changed, func(i, j int) bool { return r.Changed[i].FileName < r.Changed[j].FileName })
+	return r
+}
+
+func sortRefs(refs []NoteRef) {
+	sort.Slice(refs, func(i, j int) bool { return refs[i].FileName < refs[j].FileName })
+}
+
+func compareNote(o, n *loader.Note) (Change, bool) {
+	c := Change{NoteRef: ref(n)}
+	if o.Title != n.Title {
+		c.OldTitle = o.Title
+		c.Edited = true
+	}
+	c.BodyDiff = Unified(o.TextContent, n.TextContent, "a/"+o.FileName, "b/"+n.FileName)
+	c.Items = compareItems(o.ListContent, n.ListContent)
+	if c.BodyDiff != "" || len(c.Items) > 0 {
+		c.Edited = true
+	}
+	c.LabelsAdded, c.LabelsRemoved = compareLabels(o.Labels, n.Labels)
+	if o.State() != n.State() {
+		c.OldState, c.NewState = o.State(), n.State()
+	}
+	return c, c.Edited || c.LabelsChanged() || c.OldState != ""
+}
+
+// compareItems matches checklist items by text, repeated items are matched in order.
+func compareItems(before, after []loader.ListItem) []ItemChange {
+	remaining := make(map[string][]bool) // text to checked state of unmatched before items
+	for _, item := range before {
+		remaining[item.Text] = append(remaining[item.Text], item.IsChecked)
+	}
+	var changes []ItemChange
+	for _, item := range after {
+		states := remaining[item.Text]
+		if len(states) == 0 {
+			changes = append(changes, ItemChange{Change: ItemAdded, Text: item.Text})
+			continue
+		}
+		remaining[item.Text] = states[1:]
+		switch {
+		case item.IsChecked && !states[0]:
+			changes = append(changes, ItemChange{Change: ItemChecked, Text: item.Text})
+		case !item.IsChecked && states[0]:
+			changes = append(changes, ItemChange{Change: ItemUnchecked, Text: item.Text})
+		}
+	}
+	for _, item := range before {
+		if states := remaining[item.Text]; len(states) > 0 {
+			remaining[item.Text] = states[1:]
+			changes = append(changes, ItemChange{Change: ItemRemoved, Text: item.Text})
+		}
+	}
+	return changes
+}
+
+func compareLabels(before, after []loader.ListLabel) (added, removed []string) {
+	has := func(labels []loader.ListLabel, name string) bool {
+		for _, l := range labels {
+			if l.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+	for _, l := range after {
+		if !has(before, l.Name) {
+			added = append(added, l.Name)
+		}
+	}
+	for _, l := range before {
+		if !has(after, l.Name) {
+			removed = append(removed, l.Name)
+		}
+	}
+	return added, removed
+}
+
+func (r *Result) PrintJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(r)
+}
+
+// PrintText writes a human-readable summary followed by every change, bodies as unified diffs.
+func (r *Result) PrintText(w io.Writer) error {
+	edited, relabelled := 0, 0
+	for _, c := range r.Changed {
+		if c.Edited {
+			edited++
+		}
+		if c.LabelsChanged() {
+			relabelled++
+		}
+	}
+	fmt.Fprintf(w, "%d added, %d deleted, %d edited, %d label changes, %d unchanged\n",
+		len(r.Added), len(r.Deleted), edited, relabelled, r.Unchanged)
+	for _, n := range r.Added {
+		fmt.Fprintf(w, "\nadded %s %s: %s\n", n.ID, n.FileName, n.Title)
+	}
+	for _, n := range r.Deleted {
+		fmt.Fprintf(w, "\ndeleted %s %s: %s\n", n.ID, n.FileName, n.Title)
+	}
+	for _, c := range r.Changed {
+		fmt.Fprintf(w, "\nchanged %s %s: %s\n", c.ID, c.FileName, c.Title)
+		if c.OldTitle != "" {
+			fmt.Fprintf(w, "  title: %q -> %q\n", c.OldTitle, c.Title)
+		}
+		if c.OldState != "" {
+			fmt.Fprintf(w, "  state: %s -> %s\n", c.OldState, c.NewState)
+		}
+		if len(c.LabelsAdded) > 0 {
+			fmt.Fprintf(w, "  labels added: %s\n", strings.Join(c.LabelsAdded, ", "))
+		}
+		if len(c.LabelsRemoved) > 0 {
+			fmt.Fprintf(w, "  labels removed: %s\n", strings.Join(c.LabelsRemoved, ", "))
+		}
+		for _, item := range c.Items {
+			fmt.Fprintf(w, "  item %s: %s\n", item.Change, item.Text)
+		}
+		if c.BodyDiff != "" {
+			if _, err := io.WriteString(w, c.BodyDiff); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
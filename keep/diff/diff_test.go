@@ -0,0 +1,155 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+)
+
+var created = loader.MicroTime(time.Date(2021, time.June, 17, 0, 0, 0, 0, time.UTC))
+
+func note(name string) *loader.Note {
+	return &loader.Note{FileName: name, Title: name, CreatedMicros: &created}
+}
+
+func items(pairs ...interface{}) []loader.ListItem {
+	var list []loader.ListItem
+	for i := 0; i < len(pairs); i += 2 {
+		list = append(list, loader.ListItem{Text: pairs[i].(string), IsChecked: pairs[i+1].(bool)})
+	}
+	return list
+}
+
+func TestCompareItems(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		before, after []loader.ListItem
+		want          []ItemChange
+	}{
+		{
+			name:   "unchanged",
+			before: items("milk", false, "eggs", true),
+			after:  items("eggs", true, "milk", false), // order doesn't matter
+		},
+		{
+			name:   "checked, unchecked, added and removed",
+			before: items("milk", false, "eggs", true, "jam", false),
+			after:  items("milk", true, "eggs", false, "bread", false),
+			want: []ItemChange{
+				{Change: ItemChecked, Text: "milk"},
+				{Change: ItemUnchecked, Text: "eggs"},
+				{Change: ItemAdded, Text: "bread"},
+				{Change: ItemRemoved, Text: "jam"},
+			},
+		},
+		{
+			name:   "repeated items are matched in order",
+			before: items("milk", false, "milk", false),
+			after:  items("milk", true, "milk", false),
+			want:   []ItemChange{{Change: ItemChecked, Text: "milk"}},
+		},
+		{
+			name:   "one of a repeated item removed",
+			before: items("milk", false, "milk", true),
+			after:  items("milk", false),
+			want:   []ItemChange{{Change: ItemRemoved, Text: "milk"}},
+		},
+		{
+			name:   "repeated item added",
+			before: items("milk", false),
+			after:  items("milk", false, "milk", false),
+			want:   []ItemChange{{Change: ItemAdded, Text: "milk"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := compareItems(tc.before, tc.after); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("compareItems() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	kept, deleted, edited, relabelled, archived := note("kept"), note("deleted"), note("edited"), note("relabelled"), note("archived")
+	kept.TextContent = "same"
+	edited.TextContent = "one\ntwo\n"
+	relabelled.Labels = []loader.ListLabel{{Name: "home"}, {Name: "old"}}
+	before := map[string]*loader.Note{}
+	for _, n := range []*loader.Note{kept, deleted, edited, relabelled, archived} {
+		before[n.ID()] = n
+	}
+
+	added := note("added")
+	editedAfter := *edited
+	editedAfter.Title = "edited title"
+	editedAfter.TextContent = "one\n2\n"
+	relabelledAfter := *relabelled
+	relabelledAfter.Labels = []loader.ListLabel{{Name: "home"}, {Name: "new"}}
+	archivedAfter := *archived
+	archivedAfter.IsArchived = true
+	after := map[string]*loader.Note{}
+	for _, n := range []*loader.Note{kept, added, &editedAfter, &relabelledAfter, &archivedAfter} {
+		after[n.ID()] = n
+	}
+
+	r := Compare(before, after)
+	if len(r.Added) != 1 || r.Added[0].FileName != "added" {
+		t.Errorf("added %+v, want added", r.Added)
+	}
+	if len(r.Deleted) != 1 || r.Deleted[0].FileName != "deleted" {
+		t.Errorf("deleted %+v, want deleted", r.Deleted)
+	}
+	if r.Unchanged != 1 {
+		t.Errorf("%d unchanged, want 1", r.Unchanged)
+	}
+	if len(r.Changed) != 3 {
+		t.Fatalf("changed %+v, want archived, edited and relabelled", r.Changed)
+	}
+	byName := make(map[string]Change)
+	for _, c := range r.Changed {
+		byName[c.FileName] = c
+	}
+
+	e := byName["edited"]
+	if !e.Edited || e.OldTitle != "edited" || e.LabelsChanged() {
+		t.Errorf("got edited change %+v, want a retitled edit", e)
+	}
+	if want := "--- a/edited\n+++ b/edited\n@@ -1,2 +1,2 @@\n one\n-two\n+2\n"; e.BodyDiff != want {
+		t.Errorf("got body diff\n%s\nwant\n%s", e.BodyDiff, want)
+	}
+
+	l := byName["relabelled"]
+	if l.Edited || fmt.Sprint(l.LabelsAdded) != "[new]" || fmt.Sprint(l.LabelsRemoved) != "[old]" {
+		t.Errorf("got relabelled change %+v, want new added and old removed", l)
+	}
+
+	a := byName["archived"]
+	if a.Edited || a.OldState != loader.StateActive || a.NewState != loader.StateArchived {
+		t.Errorf("got archived change %+v, want it moved from active to archived", a)
+	}
+}
+
+// source streams a fixed list of notes.
+type source []*loader.Note
+
+func (s source) StreamNotes(_ context.Context, fun func(*loader.Note) error) error {
+	for _, n := range s {
+		if err := fun(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestLoadRejectsSameID(t *testing.T) {
+	if _, err := Load(context.Background(), source{note("a"), note("b")}); err != nil {
+		t.Errorf("Load() = %v, want no error", err)
+	}
+	if _, err := Load(context.Background(), source{note("a"), note("a")}); err == nil {
+		t.Errorf("Load() of 2 notes with the same id succeeded, want an error")
+	}
+}
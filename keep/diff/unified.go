@@ -0,0 +1,156 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines around each change in a unified diff, the same as diff -u.
+const contextLines = 3
+
+// maxCells caps the line comparison table, bigger changes are shown as the whole body replaced.
+const maxCells = 4_000_000
+
+type op struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// Unified is a unified diff of two texts by line, empty if they are the same.
+func Unified(from, to, fromName, toName string) string {
+	if from == to {
+		return ""
+	}
+	ops := lineOps(splitLines(from), splitLines(to))
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	for start := 0; start < len(ops); {
+		// find the next change then grow the hunk until changes are more than 2*context apart
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		hunkStart := max(first-contextLines, start)
+		end := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end = i + 1
+			} else if i-end >= 2*contextLines {
+				break
+			}
+		}
+		hunkEnd := min(end+contextLines, len(ops))
+		writeHunk(&sb, ops, hunkStart, hunkEnd)
+		start = hunkEnd
+	}
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, ops []op, start, end int) {
+	// line numbers are 1 based, counted from the start of each text
+	fromLine, toLine := 1, 1
+	for _, o := range ops[:start] {
+		if o.kind != '+' {
+			fromLine++
+		}
+		if o.kind != '-' {
+			toLine++
+		}
+	}
+	fromCount, toCount := 0, 0
+	for _, o := range ops[start:end] {
+		if o.kind != '+' {
+			fromCount++
+		}
+		if o.kind != '-' {
+			toCount++
+		}
+	}
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(fromLine, fromCount), hunkRange(toLine, toCount))
+	for _, o := range ops[start:end] {
+		sb.WriteByte(o.kind)
+		sb.WriteString(o.line)
+		sb.WriteByte('\n')
+	}
+}
+
+// hunkRange follows diff -u, a range with no lines starts at the line before it.
+func hunkRange(line, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", line-1)
+	case 1:
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// lineOps is the shortest edit from a to b, using the longest common subsequence of lines.
+func lineOps(a, b []string) []op {
+	var ops []op
+	// lines shared at the start and end don't need the table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, op{' ', a[prefix]})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	if len(midA)*len(midB) > maxCells {
+		for _, l := range midA {
+			ops = append(ops, op{'-', l})
+		}
+		for _, l := range midB {
+			ops = append(ops, op{'+', l})
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of midA[i:] and midB[j:]
+		lcs := make([][]int, len(midA)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(midB)+1)
+		}
+		for i := len(midA) - 1; i >= 0; i-- {
+			for j := len(midB) - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(midA) || j < len(midB) {
+			switch {
+			case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+				ops = append(ops, op{' ', midA[i]})
+				i++
+				j++
+			case j == len(midB) || i < len(midA) && lcs[i+1][j] >= lcs[i][j+1]:
+				ops = append(ops, op{'-', midA[i]})
+				i++
+			default:
+				ops = append(ops, op{'+', midB[j]})
+				j++
+			}
+		}
+	}
+
+	for _, l := range a[len(a)-suffix:] {
+		ops = append(ops, op{' ', l})
+	}
+	return ops
+}
@@ -0,0 +1,117 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numbered is the lines 1 to n, edits replace lines by number, an empty edit removes the line.
+func numbered(n int, edits map[int]string) string {
+	sb := strings.Builder{}
+	for i := 1; i <= n; i++ {
+		line, ok := edits[i]
+		if !ok {
+			line = fmt.Sprint(i)
+		} else if line == "" {
+			continue
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+func TestUnified(t *testing.T) {
+	// expected hunks match diff -u
+	for _, tc := range []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{
+			name: "same",
+			from: "a\nb\n",
+			to:   "a\nb\n",
+		},
+		{
+			name: "replaced line with context",
+			from: numbered(10, nil),
+			to:   numbered(10, map[int]string{5: "five"}),
+			want: "@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "inserted line",
+			from: "x\ny\n",
+			to:   "x\nnew\ny\n",
+			want: "@@ -1,2 +1,3 @@\n x\n+new\n y\n",
+		},
+		{
+			name: "nearby changes share a hunk",
+			from: numbered(12, nil),
+			to:   numbered(12, map[int]string{2: "two", 8: "eight"}),
+			want: "@@ -1,11 +1,11 @@\n 1\n-2\n+two\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n 9\n 10\n 11\n",
+		},
+		{
+			name: "distant changes get their own hunks",
+			from: numbered(14, nil),
+			to:   numbered(14, map[int]string{2: "two", 12: ""}),
+			want: "@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n" +
+				"@@ -9,6 +9,5 @@\n 9\n 10\n 11\n-12\n 13\n 14\n",
+		},
+		{
+			name: "everything deleted",
+			from: "a\nb\n",
+			to:   "",
+			want: "@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "everything added",
+			from: "",
+			to:   "a\nb\n",
+			want: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			// unlike diff -u a missing final newline isn't marked, note bodies rarely end in one
+			name: "missing trailing newline",
+			from: "a\nb",
+			to:   "a\nc",
+			want: "@@ -1,2 +1,2 @@\n a\n-b\n+c\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want := tc.want
+			if want != "" {
+				want = "--- a/note\n+++ b/note\n" + want
+			}
+			if got := Unified(tc.from, tc.to, "a/note", "b/note"); got != want {
+				t.Errorf("Unified() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestUnifiedReplacesHugeChangesWhole(t *testing.T) {
+	var from, to []string
+	for i := 0; i < 2100; i++ {
+		from = append(from, fmt.Sprintf("a%d", i))
+		to = append(to, fmt.Sprintf("b%d", i))
+	}
+	got := Unified("same\n"+strings.Join(from, "\n"), "same\n"+strings.Join(to, "\n"), "a", "b")
+	if !strings.HasPrefix(got, "--- a\n+++ b\n@@ -1,2101 +1,2101 @@\n same\n-a0\n") {
+		t.Errorf("Unified() starts %q, want every line replaced after the shared one", got[:min(len(got), 60)])
+	}
+	if n := strings.Count(got, "\n-"); n != 2100 {
+		t.Errorf("got %d removed lines, want 2100", n)
+	}
+}
+
+func TestLineOpsIsMinimal(t *testing.T) {
+	ops := lineOps(strings.Fields("a b c d e f"), strings.Fields("a x c d y f"))
+	var sb strings.Builder
+	for _, o := range ops {
+		sb.WriteString(string(o.kind) + o.line + " ")
+	}
+	if got, want := sb.String(), " a -b +x  c  d -e +y  f "; got != want {
+		t.Errorf("lineOps() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,153 @@
+package keep
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"path/filepath"
+
+	"filippo.io/age"
+)
+
+// EncryptedExt is added to every file encrypted with age.
+const EncryptedExt = ".age"
+
+// EncryptSink encrypts every file with age before passing it on to Sink as `${destination}.age`.
+type EncryptSink struct {
+	Sink       Sink
+	Recipients []age.Recipient
+}
+
+func (e *EncryptSink) Write(destination string, data []byte, modTime time.Time) (string, error) {
+	encrypted, err := Encrypt(data, e.Recipients...)
+	if err != nil {
+		return "", fmt.Errorf("error encrypting %s: %v", destination, err)
+	}
+	return e.Sink.Write(e.Rename(destination), encrypted, modTime)
+}
+
+func (e *EncryptSink) Rename(destination string) string { return destination + EncryptedExt }
+
+func (e *EncryptSink) Close() error { return e.Sink.Close() }
+
+// Encrypt encrypts data to every recipient in the age format.
+func Encrypt(data []byte, recipients ...age.Recipient) ([]byte, error) {
+	buf := bytes.Buffer{}
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseRecipients builds age recipients from public keys (age1...), a file of them, or a passphrase.
+// age doesn't allow a passphrase to be mixed with public keys.
+func ParseRecipients(keys []string, keysFile string, passphrase string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, k := range keys {
+		r, err := age.ParseX25519Recipient(k)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing recipient %q: %v", k, err)
+		}
+		recipients = append(recipients, r)
+	}
+	if keysFile != "" {
+		f, err := os.Open(keysFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		fileRecipients, err := age.ParseRecipients(f)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing recipients file %s: %v", keysFile, err)
+		}
+		recipients = append(recipients, fileRecipients...)
+	}
+	if passphrase != "" {
+		if len(recipients) > 0 {
+			return nil, fmt.Errorf("a passphrase can't be combined with recipient keys")
+		}
+		r, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+// ParseIdentities builds age identities from an identity file (as made by age-keygen) or a passphrase.
+func ParseIdentities(identityFile string, passphrase string) ([]age.Identity, error) {
+	var identities []age.Identity
+	if identityFile != "" {
+		f, err := os.Open(identityFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		fileIdentities, err := age.ParseIdentities(f)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing identity file %s: %v", identityFile, err)
+		}
+		identities = append(identities, fileIdentities...)
+	}
+	if passphrase != "" {
+		id, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, id)
+	}
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no identity file or passphrase to decrypt with")
+	}
+	return identities, nil
+}
+
+// DecryptFile decrypts an age file to destination, written atomically so a wrong key doesn't leave partial files.
+func DecryptFile(source, destination string, identities ...age.Identity) error {
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := age.Decrypt(f, identities...)
+	if err != nil {
+		return fmt.Errorf("error decrypting %s: %v", source, err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error decrypting %s: %v", source, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(destination, data); err != nil {
+		return err
+	}
+	// keep the export's file times, eg: from --preserve_mod_time
+	if info, err := f.Stat(); err == nil {
+		return os.Chtimes(destination, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+// DecryptedPath is where an encrypted file is restored to, the same path without .age.
+func DecryptedPath(path string) string {
+	return strings.TrimSuffix(path, EncryptedExt)
+}
+
+var (
+	_ Sink    = (*EncryptSink)(nil)
+	_ Renamer = (*EncryptSink)(nil)
+)
@@ -0,0 +1,169 @@
+// Package export runs notes from a source through filters into writers, this is everything the CLI does minus flags.
+package export
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep"
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+)
+
+type Options struct {
+	Source  loader.NoteSource
+	Filters loader.Filters // notes must pass every filter to be written
+	Writers []keep.NoteWriter
+	// Transformers run in order on every note that passes Filters, before it reaches the writers.
+	Transformers []keep.Transformer
+
+	// Parallelism is the max number of note writes in flight, defaults to the number of CPUs.
+	// Reading from Source pauses while every worker is busy.
+	Parallelism int
+	// KeepGoing records failed writes in the report and carries on instead of cancelling the run.
+	KeepGoing bool
+	// OnSkip is optionally called with every note rejected by Filters and the name of the filter.
+	OnSkip func(n *loader.Note, reason string)
+}
+
+// WriterName identifies a writer in reports, writers can implement keep.Named to pick their own.
+func WriterName(w keep.NoteWriter) string {
+	return nameOf(w)
+}
+
+// TransformerName identifies a transformer in reports, like WriterName.
+func TransformerName(t keep.Transformer) string {
+	return nameOf(t)
+}
+
+func nameOf(v interface{}) string {
+	if named, ok := v.(keep.Named); ok && named.Name() != "" {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// Run streams every note from the source through the filters to all writers then flushes them.
+// The report is always returned, the error is set if the run was cut short or anything failed.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	report := &Report{Written: make(map[string]int)}
+	if opts.Source == nil {
+		return report, fmt.Errorf("no note source")
+	}
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = runtime.NumCPU()
+	}
+	names := make([]string, len(opts.Writers))
+	for i, w := range opts.Writers {
+		names[i] = WriterName(w)
+	}
+
+	var mu sync.Mutex // guards report while writes are in flight
+	fail := func(writer string, n *loader.Note, err error) {
+		f := Failure{Writer: writer, Error: err.Error()}
+		if n != nil {
+			f.NoteID, f.FileName = n.ID(), n.FileName
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		report.Failures = append(report.Failures, f)
+	}
+
+	var counting sync.WaitGroup
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(parallelism)
+	readErr := opts.Source.StreamNotes(gctx, func(note *loader.Note) error {
+		n := note // local ref
+		mu.Lock()
+		report.markRead(n)
+		for _, w := range n.Warnings {
+			report.Warnings = append(report.Warnings, noteMessage(n, w))
+		}
+		reason, rejected := opts.Filters.Reject(n)
+		if rejected {
+			report.NotesSkipped++
+			report.Skipped = append(report.Skipped, noteMessage(n, reason))
+		}
+		mu.Unlock()
+		if rejected {
+			if opts.OnSkip != nil {
+				opts.OnSkip(n, reason)
+			}
+			return nil
+		}
+		for _, t := range opts.Transformers {
+			if err := t.Transform(gctx, n); err != nil {
+				name := TransformerName(t)
+				fail(name, n, err)
+				if opts.KeepGoing {
+					return nil // the note isn't written half transformed
+				}
+				return fmt.Errorf("error transforming %s with %s: %v", n.FileName, name, err)
+			}
+		}
+
+		var remaining sync.WaitGroup
+		failed := false
+		for i, wc := range opts.Writers {
+			wc, name := wc, names[i] // local ref
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			remaining.Add(1)
+			g.Go(func() error {
+				defer remaining.Done()
+				if err := gctx.Err(); err != nil {
+					return err
+				}
+				if err := wc.WriteNote(gctx, n); err != nil {
+					fail(name, n, err)
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+					if opts.KeepGoing {
+						return nil
+					}
+					return fmt.Errorf("error writing %s with %s: %v", n.FileName, name, err)
+				}
+				mu.Lock()
+				report.Written[name]++
+				mu.Unlock()
+				return nil
+			})
+		}
+		// counted once every writer is done with the note
+		counting.Add(1)
+		go func() {
+			defer counting.Done()
+			remaining.Wait()
+			mu.Lock()
+			defer mu.Unlock()
+			if !failed {
+				report.NotesExported++
+			}
+		}()
+		return nil
+	})
+	writeErr := g.Wait()
+	counting.Wait()
+	if writeErr != nil {
+		return report, writeErr // report the write that cancelled reading rather than the cancellation
+	}
+	if readErr != nil {
+		return report, readErr
+	}
+
+	for i, wc := range opts.Writers {
+		if err := wc.Flush(ctx); err != nil {
+			fail(names[i], nil, fmt.Errorf("error flushing: %v", err))
+		}
+	}
+	if report.Failed() {
+		return report, fmt.Errorf("%d failures while exporting", len(report.Failures))
+	}
+	return report, nil
+}
@@ -0,0 +1,172 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"archive/zip"
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep"
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+	"github.com/dragon1672/go-keep-export-to-text/keep/output/text"
+)
+
+// syntheticNotes is the size of the benchmark takeout.
+const syntheticNotes = 50000
+
+// writeSyntheticTakeout writes a takeout zip of n notes, mixing text notes and checklists of varying length.
+func writeSyntheticTakeout(path string, n int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	start := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		created := start.Add(time.Duration(i) * 97 * time.Minute)
+		note := map[string]interface{}{
+			"color":                   "DEFAULT",
+			"title":                   fmt.Sprintf("note %d", i),
+			"createdTimestampUsec":    created.UnixMicro(),
+			"userEditedTimestampUsec": created.Add(time.Hour).UnixMicro(),
+			"labels":                  []map[string]string{{"name": fmt.Sprintf("label %d", i%20)}},
+		}
+		if i%3 == 0 {
+			var items []map[string]interface{}
+			for j := 0; j < 5+i%15; j++ {
+				items = append(items, map[string]interface{}{"text": fmt.Sprintf("item %d of note %d", j, i), "isChecked": j%2 == 0})
+			}
+			note["listContent"] = items
+		} else {
+			body := ""
+			for j := 0; j < 20+i%200; j++ {
+				body += fmt.Sprintf("word%d ", j)
+			}
+			note["textContent"] = body
+		}
+		w, err := zw.Create(fmt.Sprintf("Takeout/Keep/note %d.json", i))
+		if err != nil {
+			return err
+		}
+		if err := json.NewEncoder(w).Encode(note); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// slowSink stands in for a disk slower than the zip can be read, it handles a few writes at a time taking latency each.
+// The peak number of writes waiting on or using the disk is tracked.
+type slowSink struct {
+	latency time.Duration
+	disk    chan struct{} // one slot per write the disk handles at once
+	pending atomic.Int64
+	peak    atomic.Int64
+}
+
+func newSlowSink(latency time.Duration, concurrency int) *slowSink {
+	return &slowSink{latency: latency, disk: make(chan struct{}, concurrency)}
+}
+
+func (s *slowSink) Write(destination string, _ []byte, _ time.Time) (string, error) {
+	n := s.pending.Add(1)
+	defer s.pending.Add(-1)
+	for {
+		peak := s.peak.Load()
+		if n <= peak || s.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	s.disk <- struct{}{}
+	defer func() { <-s.disk }()
+	time.Sleep(s.latency)
+	return destination, nil
+}
+
+func (s *slowSink) Close() error { return nil }
+
+// BenchmarkRun exports a synthetic 50k note takeout to the text writer, comparing bounded and unbounded parallelism.
+// Alongside time per export it reports the peak number of writes waiting on the sink and the peak heap in use.
+// The sink is the bottleneck, so unbounded parallelism reads most of the zip into goroutines queued on it,
+// while bounded parallelism pauses reading and keeps both flat in about the same time.
+func BenchmarkRun(b *testing.B) {
+	zipPath := filepath.Join(b.TempDir(), "takeout.zip")
+	if err := writeSyntheticTakeout(zipPath, syntheticNotes); err != nil {
+		b.Fatal(err)
+	}
+	for _, bc := range []struct {
+		name        string
+		parallelism int
+	}{
+		{"parallelism_4", 4},
+		{"parallelism_64", 64},
+		{"unbounded", math.MaxInt32},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var peakHeap uint64
+			var peakPending int64
+			for i := 0; i < b.N; i++ {
+				sink := newSlowSink(time.Millisecond, 4)
+				writer := &text.Writer{
+					Writer:    &keep.FileWriter{Name: "text", Sink: sink},
+					Generator: &keep.FileNameGenerator{NameStrat: keep.StratDirectExport},
+					OutDir:    "out",
+				}
+				source := &loader.ZipSource{
+					Reader: &loader.ZipToNoteReader{SubFolderPath: "Takeout/Keep/", ParseWorkers: runtime.NumCPU()},
+					Path:   zipPath,
+				}
+
+				done := make(chan struct{})
+				sampled := make(chan uint64)
+				go func() { sampled <- sampleHeap(done) }()
+				report, err := Run(context.Background(), Options{
+					Source:      source,
+					Writers:     []keep.NoteWriter{writer},
+					Parallelism: bc.parallelism,
+				})
+				close(done)
+				peakHeap = max(peakHeap, <-sampled)
+				peakPending = max(peakPending, sink.peak.Load())
+				if err != nil {
+					b.Fatal(err)
+				}
+				if report.NotesExported != syntheticNotes {
+					b.Fatalf("exported %d notes, want %d", report.NotesExported, syntheticNotes)
+				}
+			}
+			b.ReportMetric(float64(peakPending), "peak-pending-writes")
+			b.ReportMetric(float64(peakHeap)/(1<<20), "peak-heap-MiB")
+		})
+	}
+}
+
+// sampleHeap polls the heap in use until done is closed, returning the largest sample.
+func sampleHeap(done <-chan struct{}) uint64 {
+	var peak uint64
+	var stats runtime.MemStats
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		runtime.ReadMemStats(&stats)
+		peak = max(peak, stats.HeapInuse)
+		select {
+		case <-done:
+			return peak
+		case <-ticker.C:
+		}
+	}
+}
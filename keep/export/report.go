@@ -0,0 +1,134 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"encoding/json"
+	"text/tabwriter"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep/dedup"
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+)
+
+// Report summarises a run.
+type Report struct {
+	NotesRead     int             `json:"notes_read"`
+	NotesSkipped  int             `json:"notes_skipped"`
+	NotesExported int             `json:"notes_exported"` // passed the filters and every writer succeeded
+	Written       map[string]int  `json:"written"`        // notes written per writer
+	Skipped       []NoteMessage   `json:"skipped"`        // message is the filter that rejected the note
+	Warnings      []NoteMessage   `json:"warnings"`
+	Failures      []Failure       `json:"failures"`
+	Rejects       []loader.Reject `json:"rejects"`    // unreadable entries skipped by a lenient source
+	Duplicates    []dedup.Group   `json:"duplicates"` // found by the dedup stage
+
+	read map[string]bool // id of every note read, skipped or not
+}
+
+// NoteMessage ties a message to a note.
+type NoteMessage struct {
+	NoteID   string `json:"note_id"`
+	FileName string `json:"file_name"`
+	Message  string `json:"message"`
+}
+
+// Failure is a single failed transform, write or flush, flushes have no note.
+type Failure struct {
+	Writer   string `json:"writer"` // or the transformer that failed
+	NoteID   string `json:"note_id,omitempty"`
+	FileName string `json:"file_name,omitempty"`
+	Error    string `json:"error"`
+}
+
+func noteMessage(n *loader.Note, message string) NoteMessage {
+	return NoteMessage{NoteID: n.ID(), FileName: n.FileName, Message: message}
+}
+
+// AddSkipped records a note skipped before it reached Run, eg: a dropped duplicate.
+func (r *Report) AddSkipped(n *loader.Note, reason string) {
+	r.markRead(n)
+	r.NotesSkipped++
+	r.Skipped = append(r.Skipped, noteMessage(n, reason))
+}
+
+func (r *Report) markRead(n *loader.Note) {
+	if r.read == nil {
+		r.read = make(map[string]bool)
+	}
+	r.NotesRead++
+	r.read[n.ID()] = true
+}
+
+// Read reports if the note with id was read this run, whether or not it was exported.
+func (r *Report) Read(id string) bool {
+	return r.read[id]
+}
+
+// Failed reports if anything went wrong during the run.
+func (r *Report) Failed() bool {
+	return len(r.Failures) > 0
+}
+
+func (r *Report) PrintJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(r)
+}
+
+// PrintTable writes a human-readable summary, listing every failure and warning.
+func (r *Report) PrintTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "notes read\t%d\n", r.NotesRead)
+	fmt.Fprintf(tw, "notes exported\t%d\n", r.NotesExported)
+	fmt.Fprintf(tw, "notes skipped\t%d\n", r.NotesSkipped)
+
+	reasons := make(map[string]int)
+	for _, s := range r.Skipped {
+		reasons[s.Message]++
+	}
+	for _, reason := range sortedKeys(reasons) {
+		fmt.Fprintf(tw, "  %s\t%d\n", reason, reasons[reason])
+	}
+	for _, writer := range sortedKeys(r.Written) {
+		fmt.Fprintf(tw, "written by %s\t%d\n", writer, r.Written[writer])
+	}
+	fmt.Fprintf(tw, "warnings\t%d\n", len(r.Warnings))
+	for _, m := range r.Warnings {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", m.NoteID, m.FileName, m.Message)
+	}
+	if len(r.Rejects) > 0 {
+		fmt.Fprintf(tw, "rejected entries\t%d\n", len(r.Rejects))
+		for _, rej := range r.Rejects {
+			fmt.Fprintf(tw, "  %s\t%s\n", rej.Entry, rej.Error)
+		}
+	}
+	if len(r.Duplicates) > 0 {
+		fmt.Fprintf(tw, "duplicate groups\t%d\n", len(r.Duplicates))
+		for _, g := range r.Duplicates {
+			match := "exact"
+			if !g.Exact {
+				match = fmt.Sprintf("%.0f%% similar", g.Similarity*100)
+			}
+			fmt.Fprintf(tw, "  %s %s\t%d duplicates, %s\n", g.Kept.ID, g.Kept.FileName, len(g.Duplicates), match)
+			for _, d := range g.Duplicates {
+				fmt.Fprintf(tw, "    %s %s\t\n", d.ID, d.FileName)
+			}
+		}
+	}
+	fmt.Fprintf(tw, "failures\t%d\n", len(r.Failures))
+	for _, f := range r.Failures {
+		fmt.Fprintf(tw, "  %s %s %s\t%s\n", f.Writer, f.NoteID, f.FileName, f.Error)
+	}
+	return tw.Flush()
+}
+
+func sortedKeys(m map[string]int) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,453 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"path/filepath"
+
+	"filippo.io/age"
+	"github.com/golang/glog"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep"
+	"github.com/dragon1672/go-keep-export-to-text/keep/config"
+	"github.com/dragon1672/go-keep-export-to-text/keep/dedup"
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+	"github.com/dragon1672/go-keep-export-to-text/keep/output/console"
+	"github.com/dragon1672/go-keep-export-to-text/keep/output/gitrepo"
+	"github.com/dragon1672/go-keep-export-to-text/keep/output/md"
+	"github.com/dragon1672/go-keep-export-to-text/keep/output/opml"
+	"github.com/dragon1672/go-keep-export-to-text/keep/output/pdf"
+	"github.com/dragon1672/go-keep-export-to-text/keep/output/text"
+	"github.com/dragon1672/go-keep-export-to-text/keep/transform"
+)
+
+// The helpers below build the pieces of Options from a config.Config, they are everything the CLI does besides flags.
+// An export run is NewFilters, NewTransformers, NewSink, NewWriters and NewSource, then Run, then Finish.
+
+// dayRange appends filters keeping notes within the inclusive days min and max, either can be empty.
+func dayRange(filters loader.Filters, name string, noteTime func(*loader.Note) time.Time, min, max string, loc *time.Location) (loader.Filters, error) {
+	if min != "" {
+		t, err := loader.ParseDay(min, loc)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s_min %q: %v", name, min, err)
+		}
+		filters = filters.Append(name+"_min", loader.After(noteTime, t))
+	}
+	if max != "" {
+		t, err := loader.ParseDay(max, loc)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s_max %q: %v", name, max, err)
+		}
+		filters = filters.Append(name+"_max", loader.Before(noteTime, t.AddDate(0, 0, 1))) // up to the end of the day
+	}
+	return filters, nil
+}
+
+// editedSince resolves filters.edited_since, ok is false when there is nothing to filter on.
+func editedSince(cfg *config.Config, now time.Time) (t time.Time, ok bool, err error) {
+	switch cfg.Filters.EditedSince {
+	case "":
+		return t, false, nil
+	case keep.LastExport:
+		t, ok, err = keep.LoadMarker(cfg.Filters.LastExportFile)
+		if err == nil && !ok {
+			glog.Infof("no previous export recorded in %s, including every note", cfg.Filters.LastExportFile)
+		}
+		return t, ok, err
+	}
+	t, err = loader.ParseSince(cfg.Filters.EditedSince, now)
+	if err != nil {
+		return t, false, fmt.Errorf("error parsing edited since: %v", err)
+	}
+	return t, true, nil
+}
+
+// NewFilters builds the configured note filters, relative dates like `90d` count back from now.
+// Dates are read in the configured zone.
+func NewFilters(cfg *config.Config, now time.Time) (loader.Filters, error) {
+	loc, err := cfg.Location()
+	if err != nil {
+		return nil, err
+	}
+	now = now.In(loc)
+	var filters loader.Filters
+	if !cfg.Filters.IncludeTrashed {
+		filters = filters.Append("trashed", func(n *loader.Note) bool { return n.State() != loader.StateTrashed })
+	}
+	if !cfg.Filters.IncludeArchived {
+		filters = filters.Append("archived", func(n *loader.Note) bool { return n.State() != loader.StateArchived })
+	}
+
+	filters, err = dayRange(filters, "date", loader.CreatedTime, cfg.Filters.DateMin, cfg.Filters.DateMax, loc)
+	if err != nil {
+		return nil, err
+	}
+	filters, err = dayRange(filters, "edited", (*loader.Note).EditedTime, cfg.Filters.EditedMin, cfg.Filters.EditedMax, loc)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Filters.Since != "" {
+		since, err := loader.ParseSince(cfg.Filters.Since, now)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing since: %v", err)
+		}
+		filters = filters.Append("since", loader.After(loader.CreatedTime, since))
+	}
+	if since, ok, err := editedSince(cfg, now); err != nil {
+		return nil, err
+	} else if ok {
+		filters = filters.Append("edited_since", loader.After((*loader.Note).EditedTime, since))
+	}
+
+	if include := cfg.Filters.IncludeLabels; len(include) > 0 {
+		filters = filters.Append("include_labels", func(n *loader.Note) bool { return n.HasLabel(include...) })
+	}
+	if exclude := cfg.Filters.ExcludeLabels; len(exclude) > 0 {
+		filters = filters.Append("exclude_labels", func(n *loader.Note) bool { return !n.HasLabel(exclude...) })
+	}
+	if cfg.Filters.UnlabeledOnly {
+		filters = filters.Append("unlabeled_only", loader.Unlabeled(cfg.Source.DefaultTags...))
+	}
+	return filters, nil
+}
+
+// NewTransformers builds the configured transforms in order.
+func NewTransformers(cfg *config.Config) ([]keep.Transformer, error) {
+	var ts []keep.Transformer
+	for _, c := range cfg.Transforms {
+		if c.Type == transform.TypeRedact {
+			var opts transform.RedactOptions
+			if c.Redact != nil {
+				opts = *c.Redact
+			}
+			r, err := transform.NewRedactor(opts)
+			if err != nil {
+				return nil, err
+			}
+			ts = append(ts, r)
+			continue
+		}
+		rules := c.Rules
+		if c.RulesFile != "" {
+			fileRules, err := transform.LoadLabelRules(c.RulesFile)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(append([]transform.LabelRule(nil), rules...), fileRules...)
+		}
+		t, err := transform.New(c.Type, c.Max, rules)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// SourceHooks are optional callbacks from the note source, they are called on the reading goroutine.
+type SourceHooks struct {
+	OnReject    func(loader.Reject)                 // an unreadable entry skipped in lenient mode
+	OnDuplicate func(dedup.Group)                   // a group found by the dedup stage
+	OnSkip      func(n *loader.Note, reason string) // a note dropped by the dedup stage
+}
+
+// NewSource builds the configured note source: the takeout, or several merged, optionally deduplicated.
+// now is only used to build the filters the dedup stage compares notes within.
+func NewSource(cfg *config.Config, now time.Time, hooks SourceHooks) (loader.NoteSource, error) {
+	loc, err := cfg.Location()
+	if err != nil {
+		return nil, err
+	}
+	var labelMap *loader.LabelMap
+	if cfg.Source.LabelMapFile != "" {
+		m, err := loader.LoadLabelMap(cfg.Source.LabelMapFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading label map: %v", err)
+		}
+		labelMap = m
+	}
+	zipSource := func(path, quarantineDir string, onReject func(loader.Reject)) loader.NoteSource {
+		return &loader.ZipSource{
+			Reader: &loader.ZipToNoteReader{
+				SubFolderPath: cfg.Source.SubFolderPath,
+				DefaultTags:   cfg.Source.DefaultTags,
+				LabelMap:      labelMap,
+				Lenient:       cfg.Source.Lenient,
+				QuarantineDir: quarantineDir,
+				OnReject:      onReject,
+				Limits: loader.Limits{
+					MaxEntries:          cfg.Source.MaxEntries,
+					MaxEntrySize:        cfg.Source.MaxEntrySize,
+					MaxTotalSize:        cfg.Source.MaxTotalSize,
+					MaxCompressionRatio: cfg.Source.MaxCompressionRatio,
+				},
+				ParseWorkers: cfg.Source.ParseWorkers,
+				Ordered:      cfg.Source.Ordered,
+				Location:     loc,
+			},
+			Path: path,
+		}
+	}
+	source := zipSource(cfg.Source.ZipFilePath, cfg.Source.QuarantineDir, hooks.OnReject)
+	if len(cfg.Source.Merge) > 0 {
+		merged := &loader.MergeSource{TagAccount: cfg.Source.TagAccount}
+		for _, m := range cfg.Source.Merge {
+			// entries and quarantined copies are kept apart per takeout, they share paths inside the zip
+			quarantineDir := cfg.Source.QuarantineDir
+			if quarantineDir != "" {
+				quarantineDir = filepath.Join(quarantineDir, filepath.Base(m.Path))
+			}
+			var mergeReject func(loader.Reject)
+			if hooks.OnReject != nil {
+				zipName := filepath.Base(m.Path)
+				mergeReject = func(r loader.Reject) {
+					r.Entry = zipName + ":" + r.Entry
+					hooks.OnReject(r)
+				}
+			}
+			merged.Sources = append(merged.Sources, loader.NamedSource{
+				Account: m.AccountName(),
+				Source:  zipSource(m.Path, quarantineDir, mergeReject),
+			})
+		}
+		source = merged
+	}
+	if cfg.Source.Dedup == "" || cfg.Source.Dedup == "off" {
+		return source, nil
+	}
+	filters, err := NewFilters(cfg, now)
+	if err != nil {
+		return nil, err
+	}
+	return &dedup.Source{
+		Source:    source,
+		Mode:      cfg.Source.Dedup,
+		Threshold: cfg.Source.DedupThreshold,
+		Filter:    filters.AndFilter(), // only compare notes that would be exported
+		OnGroup:   hooks.OnDuplicate,
+		OnSkip:    hooks.OnSkip,
+	}, nil
+}
+
+// SourceName describes where notes are read from for errors.
+func SourceName(cfg *config.Config) string {
+	if len(cfg.Source.Merge) == 0 {
+		return "zip file " + cfg.Source.ZipFilePath
+	}
+	var paths []string
+	for _, m := range cfg.Source.Merge {
+		paths = append(paths, m.Path)
+	}
+	return "zip files " + strings.Join(paths, ", ")
+}
+
+// StreamNotes reads the configured source and passes every note that survives the filters, transformed, to fun.
+// It is Run without writers, for commands that only read notes.
+func StreamNotes(ctx context.Context, cfg *config.Config, now time.Time, hooks SourceHooks, fun func(*loader.Note) error) error {
+	filters, err := NewFilters(cfg, now)
+	if err != nil {
+		return err
+	}
+	filter := filters.AndFilter()
+	transformers, err := NewTransformers(cfg)
+	if err != nil {
+		return err
+	}
+	source, err := NewSource(cfg, now, hooks)
+	if err != nil {
+		return err
+	}
+	if err := source.StreamNotes(ctx, func(n *loader.Note) error {
+		if !filter(n) {
+			return nil
+		}
+		for _, t := range transformers {
+			if err := t.Transform(ctx, n); err != nil {
+				return fmt.Errorf("error transforming %s with %s: %v", n.FileName, TransformerName(t), err)
+			}
+		}
+		return fun(n)
+	}); err != nil {
+		return fmt.Errorf("error reading notes from %s: %v", SourceName(cfg), err)
+	}
+	return nil
+}
+
+// NewFileGenerator names the files of every writer, so notes get the same name across writers.
+func NewFileGenerator(cfg *config.Config) *keep.FileNameGenerator {
+	return &keep.FileNameGenerator{
+		GenerateYearFolders:  cfg.Output.CreateYearFolders,
+		GenerateMonthFolders: cfg.Output.CreateMonthFolders,
+		NameStrat:            cfg.Output.FileNameStrat,
+		DateLayout:           cfg.Output.FileDateLayout,
+	}
+}
+
+// NewSink picks where every writer's files go, an archive if configured otherwise the filesystem.
+// Archives are encrypted as a whole, otherwise every file is encrypted on its own.
+func NewSink(cfg *config.Config) (keep.Sink, error) {
+	recipients, err := LoadRecipients(cfg.Output.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Output.Archive != "" {
+		archive, err := keep.NewArchiveSink(cfg.Output.Archive, cfg.Output.Overwrite)
+		if err != nil {
+			return nil, err
+		}
+		archive.Recipients = recipients
+		return archive, nil
+	}
+	if cfg.Output.Encryption.PassphraseEnv != "" {
+		// age stretches the passphrase with scrypt for every file, taking about a second of CPU each
+		return nil, fmt.Errorf("passphrase encryption is only supported with an output archive, which is encrypted once, use recipient keys to encrypt files on their own")
+	}
+	var sink keep.Sink = &keep.DirSink{
+		CreateDir:  cfg.Output.CreateOut,
+		Overwrite:  cfg.Output.Overwrite,
+		SetModTime: cfg.Output.PreserveModTime,
+	}
+	if len(recipients) > 0 {
+		sink = &keep.EncryptSink{Sink: sink, Recipients: recipients}
+	}
+	return sink, nil
+}
+
+// LoadRecipients resolves the age recipients to encrypt to, none if encryption is off.
+func LoadRecipients(e config.Encryption) ([]age.Recipient, error) {
+	if !e.Enabled() {
+		return nil, nil
+	}
+	passphrase, err := EnvPassphrase(e.PassphraseEnv)
+	if err != nil {
+		return nil, err
+	}
+	recipients, err := keep.ParseRecipients(e.Recipients, e.RecipientsFile, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("encryption is configured but there are no recipients")
+	}
+	return recipients, nil
+}
+
+// EnvPassphrase reads a passphrase from the named environment variable, so it never ends up in flags or configs.
+func EnvPassphrase(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	passphrase := os.Getenv(name)
+	if passphrase == "" {
+		return "", fmt.Errorf("environment variable %s holding the passphrase is empty", name)
+	}
+	return passphrase, nil
+}
+
+// writerDir is the directory a writer produces files in.
+func writerDir(w config.Writer) string {
+	if w.Type == config.WriterOPML {
+		return filepath.Dir(w.OutputFile)
+	}
+	return w.OutDir
+}
+
+// Writers are the configured writers along with the file writers backing them, console writers don't have one.
+type Writers struct {
+	Writers     []keep.NoteWriter
+	FileWriters []*keep.FileWriter
+}
+
+// NewWriters builds the configured writers. plan is optional and switches every writer to a dry run,
+// echo also prints every file written to stdout.
+func NewWriters(cfg *config.Config, sink keep.Sink, fileGenerator *keep.FileNameGenerator, plan *keep.Plan, echo bool) (*Writers, error) {
+	ws := &Writers{}
+	seen := make(map[string]int)
+	for _, w := range cfg.Writers {
+		name := w.Type
+		if seen[w.Type] > 0 {
+			name = fmt.Sprintf("%s-%d", w.Type, seen[w.Type]+1)
+		}
+		seen[w.Type]++
+		writer := &keep.FileWriter{
+			Name:   name,
+			Stdout: echo,
+			Sink:   sink,
+			Plan:   plan,
+		}
+		if cfg.Output.Incremental && w.Type != config.WriterConsole && w.Type != config.WriterGit { // git only commits changes anyway
+			m, err := keep.LoadManifest(filepath.Join(writerDir(w), fmt.Sprintf(".keep-manifest-%s.json", name)))
+			if err != nil {
+				return nil, err
+			}
+			writer.Manifest = m
+		}
+		if w.Type != config.WriterConsole {
+			ws.FileWriters = append(ws.FileWriters, writer)
+		}
+		routing, layout := cfg.Routing(w), cfg.Output.DateLayout
+		switch w.Type {
+		case config.WriterConsole:
+			ws.Writers = append(ws.Writers, &console.StdOut{})
+		case config.WriterOPML:
+			ws.Writers = append(ws.Writers, &opml.Builder{Writer: writer, OutputFile: w.OutputFile, Routing: routing})
+		case config.WriterText:
+			ws.Writers = append(ws.Writers, &text.Writer{Writer: writer, Generator: fileGenerator, OutDir: w.OutDir, Routing: routing, DateLayout: layout})
+		case config.WriterMarkdown:
+			ws.Writers = append(ws.Writers, &md.Writer{Writer: writer, Generator: fileGenerator, OutDir: w.OutDir, Routing: routing, DateLayout: layout})
+		case config.WriterPDF:
+			ws.Writers = append(ws.Writers, &pdf.Builder{Writer: writer, OutputDir: w.OutDir, WordLimit: w.WordLimit, Routing: routing, DateLayout: layout})
+		case config.WriterGit:
+			ws.Writers = append(ws.Writers, &gitrepo.Writer{Writer: writer, Generator: fileGenerator, RepoDir: w.OutDir, Format: w.Format, Author: w.Author, Routing: routing, DateLayout: layout})
+		default:
+			return nil, fmt.Errorf("unknown writer type %q", w.Type)
+		}
+	}
+	return ws, nil
+}
+
+// Finish completes a run that wasn't a dry run: it closes the sink, saves redaction logs,
+// prunes and saves incremental manifests (printing their changes to changes, if set)
+// and records the last export time when filtering on it. start is when the run started.
+func Finish(cfg *config.Config, report *Report, sink keep.Sink, transformers []keep.Transformer, writers *Writers, start time.Time, changes io.Writer) error {
+	if err := sink.Close(); err != nil {
+		return fmt.Errorf("error closing output: %v", err)
+	}
+	for _, t := range transformers {
+		if r, ok := t.(*transform.Redactor); ok {
+			if err := r.SaveLog(); err != nil {
+				return fmt.Errorf("error saving redaction log: %v", err)
+			}
+		}
+	}
+
+	for _, fw := range writers.FileWriters {
+		if fw.Manifest == nil {
+			continue
+		}
+		if report.Failed() {
+			glog.Warningf("not pruning %s outputs since some notes failed to write", fw.Name)
+		} else if len(report.Rejects) > 0 {
+			glog.Warningf("not pruning %s outputs since some takeout entries couldn't be read", fw.Name)
+		} else if err := fw.Manifest.Prune(cfg.Output.IncrementalRemoved, report.Read); err != nil {
+			return fmt.Errorf("error pruning removed %s outputs: %v", fw.Name, err)
+		}
+		if err := fw.Manifest.Save(); err != nil {
+			return fmt.Errorf("error saving %s manifest: %v", fw.Name, err)
+		}
+		if changes != nil {
+			fw.Manifest.PrintChanges(changes, fw.Name)
+		}
+	}
+	if cfg.Filters.EditedSince == keep.LastExport && !report.Failed() {
+		if err := keep.SaveMarker(cfg.Filters.LastExportFile, start); err != nil {
+			return fmt.Errorf("error saving last export time: %v", err)
+		}
+	}
+	return nil
+}
@@ -2,11 +2,9 @@ package keep
 
 import (
 	"fmt"
-	"os"
 	"path"
 	"sync"
-
-	"path/filepath"
+	"time"
 
 	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
 )
@@ -15,89 +13,160 @@ const (
 	StratDirectExport = "direct_export"
 	StratFavorDate    = "favor_date"     // attempt to only include the date (YYYY-MM-DD) will fall back to date prefixed `YYYY-MM-DD_${direct_export}`
 	StratDateAndTitle = "date_and_title" // attempt to set (YYYY-MM-DD-TITLE) will default to (YYYY-MM-DD) if no clear title, and will fall back to date prefixed `YYYY-MM-DD_${direct_export}`
+	// StratNoteID names files after the note's id so titles aren't given away, eg: by encrypted files, falling back to `YYYY-MM-DD_${id}`
+	StratNoteID = "note_id"
 )
 
 type FileWriter struct {
-	CreateDir bool
-	Stdout    bool // also write to std out
+	Name     string    // writer name used when reporting, eg: text
+	Stdout   bool      // also write to std out
+	Sink     Sink      // where files end up, defaults to the filesystem
+	Plan     *Plan     // when set files are recorded in the plan instead of being written (dry run)
+	Manifest *Manifest // when set files unchanged since the previous run are skipped
 }
 
-func (f *FileWriter) DirPrep(destination string) error {
-	if f.CreateDir {
-		if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
-			return err
-		}
+// WriteFile writes data to destination, notes are the notes the file was generated from.
+func (f *FileWriter) WriteFile(data string, destination string, notes ...*loader.Note) error {
+	sink := f.Sink
+	if sink == nil {
+		sink = &DirSink{}
 	}
-	return nil
-}
-
-func (f *FileWriter) WriteFile(data string, destination string) error {
-	if f.CreateDir {
-		if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
-			return err
-		}
+	stored := destination
+	if r, ok := sink.(Renamer); ok {
+		stored = r.Rename(destination)
+	}
+	if f.Manifest != nil && !f.Manifest.NeedsWrite(data, stored) {
+		return nil
+	}
+	if f.Plan != nil {
+		f.Plan.AddFile(f.Name, stored, notes...)
+		return nil
 	}
 	if f.Stdout {
 		fmt.Printf("```%s\n%s\n```\n", destination, data)
 	}
-
-	destinationFile, err := os.Create(destination)
+	written, err := sink.Write(destination, []byte(data), NotesTime(notes...))
 	if err != nil {
 		return err
 	}
-	defer destinationFile.Close()
+	if f.Manifest != nil && written != "" {
+		f.Manifest.Record(data, written, notes...)
+	}
+	return nil
+}
 
-	if _, err := destinationFile.WriteString(data); err != nil {
-		return err
+// NotesTime is the newest edit time of the notes (falling back to creation time), used to timestamp outputs.
+func NotesTime(notes ...*loader.Note) time.Time {
+	var newest time.Time
+	for _, n := range notes {
+		t := n.EditedMicros
+		if t == nil {
+			t = n.CreatedMicros
+		}
+		if t != nil && t.Time().After(newest) {
+			newest = t.Time()
+		}
 	}
-	return destinationFile.Sync()
+	return newest
 }
 
 type FileNameGenerator struct {
 	GenerateYearFolders  bool
 	GenerateMonthFolders bool
 	NameStrat            string
+	DateLayout           string // layout of dates in file names, defaults to YYYY-MM-DD
 
 	mu            sync.RWMutex
-	reservedPaths map[string]bool
+	reservedPaths map[string]string // path -> note id
+	noteNames     map[string]string // state folder and note id -> path, so all writers sharing a generator agree on names
+	collisions    []Collision
+}
+
+// Collision records a note that couldn't get its preferred file name.
+type Collision struct {
+	Path         string `json:"path"`
+	NoteID       string `json:"note_id"`
+	ResolvedPath string `json:"resolved_path"`
 }
 
 type NoteWriteRequest struct {
 	note *loader.Note
 	err  chan error
 }
-func (f *FileNameGenerator) GenerateAndReserve(n *loader.Note) string {
+
+func (f *FileNameGenerator) folderPrefix(n *loader.Note, fileName string) string {
+	if f.GenerateYearFolders {
+		prefix := fmt.Sprint(n.CreatedMicros.Time().Year())
+		if f.GenerateMonthFolders {
+			month := fmt.Sprintf("%02d-%s", n.CreatedMicros.Time().Month(), n.CreatedMicros.Time().Month())
+			prefix = path.Join(prefix, month)
+		}
+		fileName = path.Join(prefix, fileName)
+	}
+	return fileName
+}
+
+func (f *FileNameGenerator) date(n *loader.Note) string {
+	layout := f.DateLayout
+	if layout == "" {
+		layout = "2006-01-02"
+	}
+	return n.CreatedMicros.Format(layout)
+}
+
+// GenerateAndReserve picks the note's file name, without extension, within stateFolder, see RoutedFolder.
+// Names are only reserved within their state folder, so archived notes don't take names from active ones.
+func (f *FileNameGenerator) GenerateAndReserve(n *loader.Note, stateFolder string) string {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	if f.reservedPaths == nil {
-		f.reservedPaths = make(map[string]bool)
+		f.reservedPaths = make(map[string]string)
+		f.noteNames = make(map[string]string)
 	}
-	fileName := n.FileName // default to STRAT_DIRECT_EXPORT
+	key := path.Join(stateFolder, n.ID())
+	if fileName, ok := f.noteNames[key]; ok {
+		return fileName // already generated for another writer
+	}
+	prefix := func(fileName string) string { return path.Join(stateFolder, f.folderPrefix(n, fileName)) }
+	fileName := prefix(n.FileName) // default to STRAT_DIRECT_EXPORT
+	fallback := prefix(fmt.Sprintf("%s_%s", f.date(n), n.FileName))
 	switch f.NameStrat {
 	case StratDirectExport:
-		fileName = n.FileName
+		fileName = prefix(n.FileName)
 	case StratFavorDate:
-		fileName = n.CreatedMicros.String() // attempt to make just the date
-		if _, ok := f.reservedPaths[fileName]; ok {
-			fileName = fmt.Sprintf("%s_%s", n.CreatedMicros.String(), n.FileName)
-		}
+		fileName = prefix(f.date(n)) // attempt to make just the date
 	case StratDateAndTitle:
-		fileName = n.CreatedMicros.String() // attempt to make just the date
+		name := f.date(n) // attempt to make just the date
 		if n.ExtractedTitle != "" {
-			fileName = fmt.Sprintf("%s_%s", fileName, n.ExtractedTitle)
-		}
-		if _, ok := f.reservedPaths[fileName]; ok {
-			fileName = fmt.Sprintf("%s_%s", n.CreatedMicros.String(), n.FileName)
+			name = fmt.Sprintf("%s_%s", name, n.ExtractedTitle)
 		}
+		fileName = prefix(name)
+	case StratNoteID:
+		fileName = prefix(n.ID())
+		fallback = prefix(fmt.Sprintf("%s_%s", f.date(n), n.ID()))
 	}
-	if f.GenerateYearFolders {
-		prefix := fmt.Sprint(n.CreatedMicros.Time().Year())
-		if f.GenerateMonthFolders {
-			month := fmt.Sprintf("%02d-%s", n.CreatedMicros.Time().Month(), n.CreatedMicros.Time().Month())
-			prefix = path.Join(prefix, month)
+	if _, ok := f.reservedPaths[fileName]; ok {
+		resolved := fallback
+		// the fallback can be taken too, eg: by a note whose title matches this note's file name
+		for i := 2; f.reserved(resolved); i++ {
+			resolved = fmt.Sprintf("%s (%d)", fallback, i)
 		}
-		fileName = path.Join(prefix, fileName)
+		f.collisions = append(f.collisions, Collision{Path: fileName, NoteID: n.ID(), ResolvedPath: resolved})
+		fileName = resolved
 	}
-	f.reservedPaths[fileName] = true
+	f.reservedPaths[fileName] = n.ID()
+	f.noteNames[key] = fileName
 	return fileName
-}
\ No newline at end of file
+}
+
+func (f *FileNameGenerator) reserved(path string) bool {
+	_, ok := f.reservedPaths[path]
+	return ok
+}
+
+// Collisions lists every note that had to fall back from its preferred name.
+func (f *FileNameGenerator) Collisions() []Collision {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return append([]Collision(nil), f.collisions...)
+}
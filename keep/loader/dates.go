@@ -0,0 +1,74 @@
+package loader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDay parses a YYYY-MM-DD date as the start of that day in loc.
+func ParseDay(s string, loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", s, loc)
+}
+
+// ParseSince parses how far back to go from now, either a YYYY-MM-DD date or a relative
+// amount such as 36h, 90d, 12w, 6m or 1y. Dates and relative days, months and years are in now's zone.
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := ParseDay(s, now.Location()); err == nil {
+		return t, nil
+	}
+	if len(s) < 2 {
+		return time.Time{}, fmt.Errorf("expected a date (YYYY-MM-DD) or amount like 90d, got %q", s)
+	}
+	amount, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || amount < 0 {
+		return time.Time{}, fmt.Errorf("expected a date (YYYY-MM-DD) or amount like 90d, got %q", s)
+	}
+	switch strings.ToLower(s[len(s)-1:]) {
+	case "h":
+		return now.Add(-time.Duration(amount) * time.Hour), nil
+	case "d":
+		return now.AddDate(0, 0, -amount), nil
+	case "w":
+		return now.AddDate(0, 0, -7*amount), nil
+	case "m":
+		return now.AddDate(0, -amount, 0), nil
+	case "y":
+		return now.AddDate(-amount, 0, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown unit in %q, expected h, d, w, m or y", s)
+}
+
+// EditedTime is when the note was last edited, falling back to when it was created.
+func (n *Note) EditedTime() time.Time {
+	if n.EditedMicros != nil {
+		return n.EditedMicros.Time()
+	}
+	if n.CreatedMicros != nil {
+		return n.CreatedMicros.Time()
+	}
+	return time.Time{}
+}
+
+// After keeps notes whose time is at or after min.
+func After(noteTime func(*Note) time.Time, min time.Time) Filter {
+	return func(n *Note) bool {
+		return !noteTime(n).Before(min)
+	}
+}
+
+// Before keeps notes whose time is strictly before max, pass the start of the next day for an inclusive day.
+func Before(noteTime func(*Note) time.Time, max time.Time) Filter {
+	return func(n *Note) bool {
+		return noteTime(n).Before(max)
+	}
+}
+
+// CreatedTime is when the note was created.
+func CreatedTime(n *Note) time.Time {
+	if n.CreatedMicros == nil {
+		return time.Time{}
+	}
+	return n.CreatedMicros.Time()
+}
@@ -0,0 +1,128 @@
+package loader
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"encoding/json"
+)
+
+// LabelMap rewrites labels as notes are loaded, so every writer sees the same labels.
+// Renames run first, then drops, then splits. Labels that end up the same are merged.
+type LabelMap struct {
+	Rename map[string]string `json:"rename"` // exact label -> new label, map several labels to one to merge them
+	Drop   []string          `json:"drop"`   // labels to remove
+	Split  *LabelSplit       `json:"split"`  // optionally rewrite hierarchies
+}
+
+// LabelSplit breaks labels starting with one of Prefixes and Separator, eg: work-projects with a prefix of work and
+// a separator of - becomes work/projects when Join is /. Other labels, like to-do, are left alone.
+// An empty Join turns each part into its own label instead.
+type LabelSplit struct {
+	Separator string   `json:"separator"`
+	Join      string   `json:"join"`
+	Prefixes  []string `json:"prefixes"` // labels to split, without the separator
+}
+
+// matches reports if name is under one of the prefixes.
+func (s *LabelSplit) matches(name string) bool {
+	for _, p := range s.Prefixes {
+		if strings.HasPrefix(name, p+s.Separator) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadLabelMap reads a JSON label map.
+func LoadLabelMap(path string) (*LabelMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &LabelMap{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("error parsing label map %s: %v", path, err)
+	}
+	if m.Split != nil && m.Split.Separator == "" {
+		return nil, fmt.Errorf("label map %s: split requires a separator", path)
+	}
+	if m.Split != nil && len(m.Split.Prefixes) == 0 {
+		return nil, fmt.Errorf("label map %s: split requires prefixes, the labels to split", path)
+	}
+	return m, nil
+}
+
+// Apply maps labels, dropping empty and duplicate labels while keeping their order.
+func (m *LabelMap) Apply(labels []ListLabel) []ListLabel {
+	drop := make(map[string]bool)
+	for _, d := range m.Drop {
+		drop[d] = true
+	}
+	var mapped []ListLabel
+	seen := make(map[string]bool)
+	add := func(name string) {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			return
+		}
+		seen[name] = true
+		mapped = append(mapped, ListLabel{Name: name})
+	}
+	for _, l := range labels {
+		name := l.Name
+		if renamed, ok := m.Rename[name]; ok {
+			name = renamed
+		}
+		if drop[name] {
+			continue
+		}
+		if m.Split == nil || !m.Split.matches(name) {
+			add(name)
+			continue
+		}
+		parts := strings.Split(name, m.Split.Separator)
+		if m.Split.Join != "" {
+			add(strings.Join(parts, m.Split.Join))
+			continue
+		}
+		for _, p := range parts {
+			add(p)
+		}
+	}
+	return mapped
+}
+
+// HasLabel reports if the note has any of the labels, ignoring case like Keep does.
+func (n *Note) HasLabel(labels ...string) bool {
+	for _, l := range n.Labels {
+		for _, want := range labels {
+			if strings.EqualFold(l.Name, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Unlabeled keeps notes with no labels other than ignored ones, pass the default tags so they don't count.
+func Unlabeled(ignored ...string) Filter {
+	return func(n *Note) bool {
+		for _, l := range n.Labels {
+			if l.Name == "" {
+				continue
+			}
+			ignore := false
+			for _, i := range ignored {
+				if strings.EqualFold(l.Name, i) {
+					ignore = true
+				}
+			}
+			if !ignore {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,79 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"archive/zip"
+)
+
+// ratioMinSize is the smallest entry the compression ratio is checked on, small files compress unpredictably.
+const ratioMinSize = 1 << 20
+
+// ErrLimit is wrapped by every limit violation, these stop a read even when lenient.
+var ErrLimit = errors.New("zip limit exceeded")
+
+// Limits guard against zip bombs and oversized archives, zero values are unlimited.
+// Only note entries are ever decompressed, attachments are skipped without being read.
+type Limits struct {
+	MaxEntries          int     // entries in the zip, including attachments
+	MaxEntrySize        int64   // uncompressed bytes per note
+	MaxTotalSize        int64   // uncompressed bytes read across every note
+	MaxCompressionRatio float64 // uncompressed / compressed size per note, checked on notes over 1 MiB
+}
+
+// DefaultLimits are generous for real takeouts while stopping anything absurd.
+var DefaultLimits = Limits{
+	MaxEntries:          1_000_000,
+	MaxEntrySize:        16 << 20,
+	MaxTotalSize:        4 << 30,
+	MaxCompressionRatio: 100,
+}
+
+// checkArchive validates limits that apply to the whole zip before anything is read.
+func (l Limits) checkArchive(r *zip.ReadCloser) error {
+	if l.MaxEntries > 0 && len(r.File) > l.MaxEntries {
+		return fmt.Errorf("%w: zip has %d entries, more than the limit of %d", ErrLimit, len(r.File), l.MaxEntries)
+	}
+	return nil
+}
+
+// checkEntry validates the sizes an entry declares before it is opened.
+func (l Limits) checkEntry(f *zip.File) error {
+	if l.MaxEntrySize > 0 && f.UncompressedSize64 > uint64(l.MaxEntrySize) {
+		return fmt.Errorf("%w: entry %s is %d bytes uncompressed, more than the limit of %d", ErrLimit, f.Name, f.UncompressedSize64, l.MaxEntrySize)
+	}
+	if l.MaxCompressionRatio > 0 && f.UncompressedSize64 >= ratioMinSize {
+		if f.CompressedSize64 == 0 {
+			return fmt.Errorf("%w: entry %s claims %d bytes from nothing", ErrLimit, f.Name, f.UncompressedSize64)
+		}
+		if ratio := float64(f.UncompressedSize64) / float64(f.CompressedSize64); ratio > l.MaxCompressionRatio {
+			return fmt.Errorf("%w: entry %s has a compression ratio of %.0f, more than the limit of %.0f", ErrLimit, f.Name, ratio, l.MaxCompressionRatio)
+		}
+	}
+	return nil
+}
+
+// limitedReader enforces the size limits while reading, since entry headers can lie.
+type limitedReader struct {
+	r      io.Reader
+	name   string
+	limits Limits
+	read   int64
+	total  *atomic.Int64 // shared across every entry in the zip
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	total := l.total.Add(int64(n))
+	if l.limits.MaxEntrySize > 0 && l.read > l.limits.MaxEntrySize {
+		return n, fmt.Errorf("%w: entry %s is larger than the limit of %d bytes", ErrLimit, l.name, l.limits.MaxEntrySize)
+	}
+	if l.limits.MaxTotalSize > 0 && total > l.limits.MaxTotalSize {
+		return n, fmt.Errorf("%w: zip is larger than the limit of %d uncompressed bytes", ErrLimit, l.limits.MaxTotalSize)
+	}
+	return n, err
+}
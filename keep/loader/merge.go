@@ -0,0 +1,58 @@
+package loader
+
+import (
+	"context"
+)
+
+// NamedSource is a NoteSource with the account it belongs to, several takeouts can share an account.
+type NamedSource struct {
+	Account string
+	Source  NoteSource
+}
+
+// MergeSource unifies notes from several takeouts, or accounts, by ID.
+// A note found in more than one source is passed on once, as its most recently edited version, ties go to the later source.
+// Every note is held until the last source is read, then they are passed on in the order they were first seen.
+type MergeSource struct {
+	Sources []NamedSource
+	// TagAccount adds the account of the version kept as a label.
+	TagAccount bool
+}
+
+func (m *MergeSource) StreamNotes(ctx context.Context, fun func(*Note) error) error {
+	var order []string
+	latest := make(map[string]*Note)
+	accounts := make(map[string]string)
+	for _, s := range m.Sources {
+		if err := s.Source.StreamNotes(ctx, func(n *Note) error {
+			id := n.ID()
+			prev, seen := latest[id]
+			if !seen {
+				order = append(order, id)
+			} else if prev.EditedTime().After(n.EditedTime()) {
+				return nil
+			}
+			latest[id] = n
+			accounts[id] = s.Account
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range order {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := latest[id]
+		if m.TagAccount && accounts[id] != "" && !n.HasLabel(accounts[id]) {
+			n.Labels = append(n.Labels, ListLabel{Name: accounts[id]})
+		}
+		if err := fun(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ NoteSource = (*MergeSource)(nil)
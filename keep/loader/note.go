@@ -1,8 +1,13 @@
 package loader
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
+
+	"crypto/sha1"
+	"encoding/hex"
 )
 
 type ListItem struct {
@@ -22,26 +27,111 @@ type Note struct {
 	TextContent    string      `json:"textContent"`
 	IsTrashed      bool        `json:"isTrashed"`
 	IsArchived     bool        `json:"isArchived"`
+	IsPinned       bool        `json:"isPinned"`
+	Color          string      `json:"color"` // eg: DEFAULT, RED, BLUE
 	ListContent    []ListItem  `json:"listContent"`
 	Labels         []ListLabel `json:"labels"`
 	EditedMicros   *MicroTime  `json:"userEditedTimestampUsec"`
 	CreatedMicros  *MicroTime  `json:"createdTimestampUsec"`
+	Warnings       []string    `json:"-"` // anything odd found while loading
+	// id is fixed by FixID, so transforms changing the file name, like redaction, don't change the identity
+	id string
+}
+
+// Note states, a trashed note can also be archived but trashed wins.
+const (
+	StateActive   = "active"
+	StateArchived = "archived"
+	StateTrashed  = "trashed"
+)
+
+// State is where the note lives in Keep.
+func (n *Note) State() string {
+	switch {
+	case n.IsTrashed:
+		return StateTrashed
+	case n.IsArchived:
+		return StateArchived
+	}
+	return StateActive
+}
+
+// ID is a short stable identity for the note, derived from the takeout file name and creation time.
+// This stays the same between takeouts as long as the note isn't renamed.
+func (n *Note) ID() string {
+	if n.id != "" {
+		return n.id
+	}
+	var created int64
+	if n.CreatedMicros != nil {
+		created = n.CreatedMicros.Time().UnixMicro()
+	}
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s@%d", n.FileName, created)))
+	return hex.EncodeToString(sum[:])[:10]
+}
+
+// FixID keeps the note's current ID for good, readers call it once a note is loaded.
+func (n *Note) FixID() {
+	n.id = ""
+	n.id = n.ID()
+}
+
+// In sets the zone the note's times are rendered in, the instants stay the same.
+func (n *Note) In(loc *time.Location) {
+	for _, t := range []*MicroTime{n.CreatedMicros, n.EditedMicros} {
+		if t != nil {
+			*t = MicroTime(time.Time(*t).In(loc))
+		}
+	}
+}
+
+// DefaultDateLayout is how dates are rendered unless another layout is configured.
+const DefaultDateLayout = "2006-01-02"
+
+// RFC3339 can be used as a date layout for RFC 3339 with the full microsecond precision of the takeout timestamps.
+const RFC3339 = "rfc3339"
+
+// rfc3339Micro is RFC 3339 with the full precision of the takeout timestamps.
+const rfc3339Micro = "2006-01-02T15:04:05.999999Z07:00"
+
+// Layout resolves a configured date layout, empty is DefaultDateLayout, RFC3339 the full timestamp
+// and anything else a Go time layout.
+func Layout(layout string) string {
+	switch layout {
+	case "":
+		return DefaultDateLayout
+	case RFC3339:
+		return rfc3339Micro
+	}
+	return layout
 }
 
 type MicroTime time.Time
 
 func (j *MicroTime) UnmarshalJSON(data []byte) error {
-	millis, err := strconv.ParseInt(string(data), 10, 64)
+	// old takeouts sometimes quote the number
+	millis, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
 	if err != nil {
 		return err
 	}
 	*j = MicroTime(time.Unix(0, millis*int64(time.Microsecond)))
 	return nil
 }
+// Time is in the zone the note was loaded in, see ZipToNoteReader.Location.
 func (j *MicroTime) Time() time.Time {
 	return time.Time(*j)
 }
+
+// Format renders the time with a layout resolved by Layout.
+func (j *MicroTime) Format(layout string) string {
+	return j.Time().Format(Layout(layout))
+}
+
+// RFC3339 is the full timestamp down to the microsecond, eg: {{.CreatedMicros.RFC3339}} in a template.
+func (j *MicroTime) RFC3339() string {
+	return j.Format(rfc3339Micro)
+}
 func (j *MicroTime) String() string {
-	return j.Time().Format("2006-01-02")
+	return j.Format(DefaultDateLayout)
 }
 
@@ -0,0 +1,83 @@
+package loader
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"archive/zip"
+)
+
+type parsed struct {
+	seq  int
+	file *zip.File
+	note *Note
+	err  error
+}
+
+// parseParallel parses files across ParseWorkers goroutines and delivers them on the calling goroutine.
+// At most a few notes per worker are in flight, so a slow callback holds back parsing rather than filling memory.
+func (z *ZipToNoteReader) parseParallel(files []*zip.File, total *atomic.Int64, fun func(*Note) error) error {
+	done := make(chan struct{})
+	defer close(done) // stops the workers if delivery fails part way
+
+	inflight := make(chan struct{}, 4*z.ParseWorkers)
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range files {
+			select {
+			case inflight <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	results := make(chan parsed)
+	var workers sync.WaitGroup
+	for w := 0; w < z.ParseWorkers; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range jobs {
+				note, err := z.file2Note(files[i], total)
+				select {
+				case results <- parsed{seq: i, file: files[i], note: note, err: err}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	pending := make(map[int]parsed) // parsed out of order, waiting on earlier notes
+	next := 0
+	for r := range results {
+		if !z.Ordered {
+			if err := z.deliver(r.file, r.note, r.err, fun); err != nil {
+				return err
+			}
+			<-inflight
+			continue
+		}
+		pending[r.seq] = r
+		for p, ok := pending[next]; ok; p, ok = pending[next] {
+			delete(pending, next)
+			next++
+			if err := z.deliver(p.file, p.note, p.err, fun); err != nil {
+				return err
+			}
+			<-inflight
+		}
+	}
+	return nil
+}
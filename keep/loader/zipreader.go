@@ -1,11 +1,15 @@
 package loader
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"archive/zip"
 	"encoding/json"
@@ -16,36 +20,95 @@ import (
 
 type Filter func(*Note) bool
 
-type Filters []Filter
+// NamedFilter is a Filter with a name reported as the reason a note was skipped.
+type NamedFilter struct {
+	Name   string
+	Filter Filter
+}
+
+type Filters []NamedFilter
 
 func (f Filters) AndFilter() Filter {
 	return func(n *Note) bool {
-		for _, filter := range f {
-			if !filter(n) {
-				return false
-			}
+		_, ok := f.Reject(n)
+		return !ok
+	}
+}
+
+// Reject returns the name of the first filter rejecting the note.
+func (f Filters) Reject(n *Note) (string, bool) {
+	for _, filter := range f {
+		if !filter.Filter(n) {
+			return filter.Name, true
 		}
-		return true
 	}
+	return "", false
+}
+
+func (f Filters) Append(name string, filter Filter) Filters {
+	return append(f, NamedFilter{Name: name, Filter: filter})
+}
+
+
+// NoteSource streams notes to fun until it runs out or fun returns an error.
+type NoteSource interface {
+	StreamNotes(ctx context.Context, fun func(*Note) error) error
 }
 
-func (f Filters) Append(filter Filter) Filters {
-	return append(f, filter)
+// ZipSource is a NoteSource reading a single takeout zip.
+type ZipSource struct {
+	Reader *ZipToNoteReader
+	Path   string
 }
 
+func (z *ZipSource) StreamNotes(ctx context.Context, fun func(*Note) error) error {
+	return z.Reader.StreamNotes(z.Path, func(n *Note) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fun(n)
+	})
+}
 
 type ZipToNoteReader struct {
 	SubFolderPath string
 	DefaultTags   []string
+	LabelMap      *LabelMap // optionally rewrites each note's labels, default tags are added after
 	Filter       Filter
+
+	// Lenient skips entries that fail to parse instead of failing the whole read, each one is passed to OnReject.
+	Lenient       bool
+	QuarantineDir string        // optionally copy rejected entries here, keeping their path in the zip
+	OnReject      func(Reject)
+
+	Limits Limits // zip bomb protection, the zero value is unlimited
+
+	// Location is the zone note times are rendered in, defaults to the local zone.
+	Location *time.Location
+
+	// ParseWorkers parses notes in parallel when more than 1, Filter and the StreamNotes callback still run one at a time.
+	ParseWorkers int
+	// Ordered delivers notes in zip order when parsing in parallel, otherwise they arrive as soon as they are parsed.
+	Ordered bool
+}
+
+// Reject is a zip entry that couldn't be read as a note.
+type Reject struct {
+	Entry       string `json:"entry"`
+	Error       string `json:"error"`
+	Quarantined string `json:"quarantined,omitempty"` // where the raw entry was copied to
 }
 
-func (z *ZipToNoteReader) streamZipFiles(source string, fun func(*zip.File) error) error {
+// streamZipFiles passes every file in the zip to fun, after checking them all for zip slip.
+func (z *ZipToNoteReader) streamZipFiles(source string, fun func([]*zip.File) error) error {
 	reader, err := zip.OpenReader(source)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
+	if err := z.Limits.checkArchive(reader); err != nil {
+		return err
+	}
 
 	// Do a check for zip slip https://snyk.io/research/zip-slip-vulnerability
 	zipSlipCheck, err := filepath.Abs(".")
@@ -53,6 +116,7 @@ func (z *ZipToNoteReader) streamZipFiles(source string, fun func(*zip.File) erro
 		return err
 	}
 
+	var files []*zip.File
 	for _, f := range reader.File {
 		if f.FileInfo().IsDir() {
 			continue // skip directories
@@ -61,33 +125,42 @@ func (z *ZipToNoteReader) streamZipFiles(source string, fun func(*zip.File) erro
 		if !strings.HasPrefix(filePath, filepath.Clean(zipSlipCheck)+string(os.PathSeparator)) {
 			return fmt.Errorf("invalid file path: %s", filePath)
 		}
-		if err := fun(f); err != nil {
-			return err
-		}
+		files = append(files, f)
 	}
-	return nil
+	return fun(files)
 }
-func (z *ZipToNoteReader) file2Note(f *zip.File) (*Note, error) {
+func (z *ZipToNoteReader) file2Note(f *zip.File, total *atomic.Int64) (*Note, error) {
+	if err := z.Limits.checkEntry(f); err != nil {
+		return nil, err
+	}
 	zippedFile, err := f.Open()
 	if err != nil {
 		return nil, err
 	}
 	defer zippedFile.Close()
 
-	data, err := io.ReadAll(zippedFile)
-	if err != nil {
-		return nil, err
-	}
 	note := &Note{
 		FileName: strings.TrimSuffix(filepath.Base(f.FileInfo().Name()), filepath.Ext(f.FileInfo().Name())),
 	}
-	if err := json.Unmarshal(data, note); err != nil {
+	decoder := json.NewDecoder(&limitedReader{r: zippedFile, name: f.Name, limits: z.Limits, total: total})
+	if err := decoder.Decode(note); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF // empty file
+		}
 		return nil, err
 	}
+	if z.Location != nil {
+		note.In(z.Location)
+	}
+	note.FixID()
 	note.ExtractedTitle = note.Title // keep the original title
 	if note.Title == "" {
 		glog.Infof("providing default title for file %v", f.FileInfo().Name())
 		note.Title = f.FileInfo().Name()
+		note.Warnings = append(note.Warnings, "no title, defaulted to file name")
+	}
+	if z.LabelMap != nil {
+		note.Labels = z.LabelMap.Apply(note.Labels)
 	}
 	for _, defaultTag := range z.DefaultTags {
 		note.Labels = append(note.Labels, ListLabel{defaultTag})
@@ -95,23 +168,82 @@ func (z *ZipToNoteReader) file2Note(f *zip.File) (*Note, error) {
 	return note, nil
 }
 func (z *ZipToNoteReader) StreamNotes(source string, fun func(*Note) error) error {
-	return z.streamZipFiles(source, func(file *zip.File) error {
-		if path.Ext(file.Name) != ".json" {
-			return nil // skip
-		}
-		if len(z.SubFolderPath) > 0 && !strings.Contains(file.Name, z.SubFolderPath) {
-			return nil // skip
+	var total atomic.Int64 // uncompressed bytes read so far
+	return z.streamZipFiles(source, func(files []*zip.File) error {
+		var notes []*zip.File
+		for _, file := range files {
+			if path.Ext(file.Name) != ".json" {
+				continue // skip
+			}
+			if len(z.SubFolderPath) > 0 && !strings.Contains(file.Name, z.SubFolderPath) {
+				continue // skip
+			}
+			notes = append(notes, file)
 		}
-		note, err := z.file2Note(file)
-		if err != nil {
-			return fmt.Errorf("error reading file %s: %v", file.Name, err)
+		if z.ParseWorkers > 1 {
+			return z.parseParallel(notes, &total, fun)
 		}
-		if z.Filter != nil {
-			if !z.Filter(note) {
-				glog.Infof("skipping filtered entry %v", file.Name)
-				return nil // skip
+		for _, file := range notes {
+			note, err := z.file2Note(file, &total)
+			if err := z.deliver(file, note, err, fun); err != nil {
+				return err
 			}
 		}
-		return fun(note)
+		return nil
 	})
-}
\ No newline at end of file
+}
+
+// deliver handles a parsed entry, this always runs on the goroutine that called StreamNotes.
+func (z *ZipToNoteReader) deliver(file *zip.File, note *Note, err error, fun func(*Note) error) error {
+	if err != nil && z.Lenient && !errors.Is(err, ErrLimit) {
+		return z.reject(file, err)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading file %s: %v", file.Name, err)
+	}
+	if z.Filter != nil {
+		if !z.Filter(note) {
+			glog.Infof("skipping filtered entry %v", file.Name)
+			return nil // skip
+		}
+	}
+	return fun(note)
+}
+
+func (z *ZipToNoteReader) reject(f *zip.File, parseErr error) error {
+	glog.Warningf("rejecting unreadable entry %s: %v", f.Name, parseErr)
+	r := Reject{Entry: f.Name, Error: parseErr.Error()}
+	if z.QuarantineDir != "" {
+		destination := filepath.Join(z.QuarantineDir, filepath.FromSlash(f.Name))
+		if err := quarantine(f, destination); err != nil {
+			return fmt.Errorf("error quarantining %s: %v", f.Name, err)
+		}
+		r.Quarantined = destination
+	}
+	if z.OnReject != nil {
+		z.OnReject(r)
+	}
+	return nil
+}
+
+// quarantine copies the raw entry out of the zip so it can be inspected later.
+func quarantine(f *zip.File, destination string) error {
+	if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+		return err
+	}
+	zippedFile, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer zippedFile.Close()
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, zippedFile); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,233 @@
+package keep
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+)
+
+// What to do with outputs of notes that were in the previous export but not this one.
+const (
+	RemovedKeep       = "keep"
+	RemovedDelete     = "delete"
+	RemovedQuarantine = "quarantine" // move into a .keep-quarantine folder next to the manifest
+)
+
+// Manifest remembers what a writer produced in previous runs, so unchanged files don't need to be rewritten.
+type Manifest struct {
+	Path  string                    `json:"-"`
+	Files map[string]*ManifestEntry `json:"files"` // keyed by output path relative to the manifest
+
+	mu       sync.Mutex
+	touched  map[string]bool
+	recorded map[string]bool // ids of notes written this run
+	// paths relative to the manifest touched by this run
+	New     []string `json:"-"`
+	Changed []string `json:"-"`
+	Same    []string `json:"-"`
+	Removed []string `json:"-"`
+}
+
+// ManifestEntry describes a single output file.
+type ManifestEntry struct {
+	Hash  string         `json:"hash"` // sha256 of the file contents
+	Notes []ManifestNote `json:"notes"`
+}
+
+type ManifestNote struct {
+	ID     string    `json:"id"`
+	Edited time.Time `json:"edited"`
+}
+
+// LoadManifest reads the manifest at path, a missing file is an empty manifest.
+func LoadManifest(path string) (*Manifest, error) {
+	m := &Manifest{Path: path, Files: make(map[string]*ManifestEntry)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("error parsing manifest %s: %v", path, err)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]*ManifestEntry)
+	}
+	return m, nil
+}
+
+func hashData(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// key makes destination relative to the manifest so exports can be moved around.
+func (m *Manifest) key(destination string) string {
+	abs, err := filepath.Abs(destination)
+	if err != nil {
+		return destination
+	}
+	dir, err := filepath.Abs(filepath.Dir(m.Path))
+	if err != nil {
+		return abs
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil {
+		return abs
+	}
+	return filepath.ToSlash(rel)
+}
+
+// path is the inverse of key.
+func (m *Manifest) path(key string) string {
+	p := filepath.FromSlash(key)
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(filepath.Dir(m.Path), p)
+}
+
+// NeedsWrite checks if destination has to be written, files matching the previous run and still on disk can be skipped.
+func (m *Manifest) NeedsWrite(data string, destination string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.touched == nil {
+		m.touched = make(map[string]bool)
+	}
+	key := m.key(destination)
+	m.touched[key] = true
+	prev, ok := m.Files[key]
+	if !ok || prev.Hash != hashData(data) {
+		return true
+	}
+	if _, err := os.Stat(destination); err != nil {
+		return true // deleted by hand since the last run
+	}
+	m.Same = append(m.Same, key)
+	return false
+}
+
+// Record marks destination as written with data from notes.
+func (m *Manifest) Record(data string, destination string, notes ...*loader.Note) {
+	entry := &ManifestEntry{Hash: hashData(data)}
+	for _, n := range notes {
+		mn := ManifestNote{ID: n.ID()}
+		if n.EditedMicros != nil {
+			mn.Edited = n.EditedMicros.Time()
+		}
+		entry.Notes = append(entry.Notes, mn)
+	}
+	key := m.key(destination)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.recorded == nil {
+		m.recorded = make(map[string]bool)
+	}
+	for _, n := range entry.Notes {
+		m.recorded[n.ID] = true
+	}
+	if _, ok := m.Files[key]; ok {
+		m.Changed = append(m.Changed, key)
+	} else {
+		m.New = append(m.New, key)
+	}
+	m.Files[key] = entry
+}
+
+// Prune handles outputs from the previous run that weren't produced this time, according to policy.
+// An empty policy keeps them. read reports if a note was read this run, outputs are only pruned once every note
+// in them is gone from the takeout or was written elsewhere, notes skipped by filters keep their outputs.
+func (m *Manifest) Prune(policy string, read func(id string) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, entry := range m.Files {
+		if m.touched[key] || m.held(entry, read) {
+			continue
+		}
+		destination := m.path(key)
+		m.Removed = append(m.Removed, key)
+		delete(m.Files, key)
+		switch policy {
+		case "", RemovedKeep:
+		case RemovedDelete:
+			if err := os.Remove(destination); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		case RemovedQuarantine:
+			if err := m.quarantine(destination); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown removed note policy %q", policy)
+		}
+	}
+	return nil
+}
+
+// held reports if any note in entry was read but not written this run, eg: it was filtered out.
+func (m *Manifest) held(entry *ManifestEntry, read func(id string) bool) bool {
+	for _, n := range entry.Notes {
+		if read(n.ID) && !m.recorded[n.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manifest) quarantine(destination string) error {
+	rel := m.key(destination)
+	if filepath.IsAbs(rel) || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(destination)
+	}
+	target := filepath.Join(filepath.Dir(m.Path), ".keep-quarantine", filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(destination, target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Save writes the manifest back to its path.
+func (m *Manifest) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.Path), os.ModePerm); err != nil {
+		return err
+	}
+	return WriteFileAtomic(m.Path, data)
+}
+
+// PrintChanges writes a summary of what changed since the previous run.
+func (m *Manifest) PrintChanges(w io.Writer, writer string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "%s: %d new, %d changed, %d unchanged, %d removed\n", writer, len(m.New), len(m.Changed), len(m.Same), len(m.Removed))
+	for _, change := range []struct {
+		prefix string
+		paths  []string
+	}{{"+", m.New}, {"~", m.Changed}, {"-", m.Removed}} {
+		sort.Strings(change.paths)
+		for _, p := range change.paths {
+			fmt.Fprintf(w, "  %s %s\n", change.prefix, p)
+		}
+	}
+}
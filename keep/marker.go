@@ -0,0 +1,32 @@
+package keep
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// LastExport is the --edited_since value that reads the time of the previous export from a marker file.
+const LastExport = "last-export"
+
+// LoadMarker reads the time saved by the previous export, ok is false if there was no previous export.
+func LoadMarker(path string) (t time.Time, ok bool, err error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, false, nil
+	}
+	if err != nil {
+		return t, false, err
+	}
+	t, err = time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return t, false, fmt.Errorf("error parsing marker %s: %v", path, err)
+	}
+	return t, true, nil
+}
+
+// SaveMarker records t as the time of the last export, use the time the export started so edits made during it aren't missed.
+func SaveMarker(path string, t time.Time) error {
+	return WriteFileAtomic(path, []byte(t.UTC().Format(time.RFC3339Nano)+"\n"))
+}
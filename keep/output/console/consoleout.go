@@ -1,6 +1,7 @@
 package console
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/dragon1672/go-keep-export-to-text/keep"
@@ -9,11 +10,13 @@ import (
 
 type StdOut struct {}
 
-func (s *StdOut) Flush() error {return nil }
+func (s *StdOut) Flush(_ context.Context) error {return nil }
 
-func (s *StdOut) WriteNote(n *loader.Note) error {
+func (s *StdOut) WriteNote(_ context.Context, n *loader.Note) error {
 	fmt.Printf("```note\n%+v\n```\n", n)
 	return nil
 }
 
+func (s *StdOut) Name() string { return "console" }
+
 var _ keep.NoteWriter = (*StdOut)(nil)
\ No newline at end of file
@@ -0,0 +1,289 @@
+// Package gitrepo writes notes into a git repository, one commit per changed note dated from the note's edit time.
+package gitrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"encoding/json"
+	"net/mail"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/golang/glog"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep"
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+	"github.com/dragon1672/go-keep-export-to-text/keep/output/md"
+	"github.com/dragon1672/go-keep-export-to-text/keep/output/text"
+)
+
+// File formats notes are committed as.
+const (
+	FormatMarkdown = "markdown"
+	FormatText     = "text"
+)
+
+// DefaultAuthor signs every commit unless another is configured.
+const DefaultAuthor = "Google Keep <keep@localhost>"
+
+// indexFile maps note IDs to their path in the repo, so a renamed note moves instead of leaving its old file behind.
+// It lives in .git since it only describes this clone.
+const indexFile = "keep-notes.json"
+
+type file struct {
+	note *loader.Note
+	path string // slash separated, relative to the repo
+	data string
+}
+
+// Writer renders notes as markdown or text files and commits each changed one to the git repo in RepoDir.
+// Notes are committed on Flush, oldest edit first, so `git log` reads as a timeline of the notes.
+// A note added to the repo is authored at its created time, every commit is committed at the note's edit time.
+type Writer struct {
+	Writer    *keep.FileWriter // name and dry run plan, files are written straight to the repo
+	Generator *keep.FileNameGenerator
+	RepoDir   string // created and initialised if needed
+	Format    string // FormatMarkdown or FormatText, defaults to markdown
+	Author    string // `Name <email>`, defaults to DefaultAuthor
+	Routing   string // how archived and trashed notes are written, see keep.RouteSplit
+	// DateLayout is the layout of the created and edited dates in each file, see loader.Layout.
+	DateLayout string
+
+	mu    sync.Mutex
+	files []file
+}
+
+func (w *Writer) WriteNote(_ context.Context, n *loader.Note) error {
+	n = keep.RouteNote(n, w.Routing)
+	name := w.Generator.GenerateAndReserve(n, keep.RoutedFolder(n, w.Routing))
+	var data, ext string
+	var err error
+	switch w.Format {
+	case "", FormatMarkdown:
+		data, err = md.Note2Md(n, w.DateLayout)
+		ext = ".md"
+	case FormatText:
+		data, err = text.Note2Txt(n, w.DateLayout)
+		ext = ".txt"
+	default:
+		err = fmt.Errorf("unknown git format %q", w.Format)
+	}
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.files = append(w.files, file{note: n, path: filepath.ToSlash(name + ext), data: data})
+	return nil
+}
+
+func (w *Writer) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	author, err := mail.ParseAddress(w.author())
+	if err != nil {
+		return fmt.Errorf("error parsing git author %q: %v", w.author(), err)
+	}
+	repo, err := w.open()
+	if err != nil {
+		return err
+	}
+	committed, err := headFiles(repo)
+	if err != nil {
+		return err
+	}
+	index, err := w.loadIndex()
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(w.files, func(i, j int) bool {
+		a, b := w.files[i], w.files[j]
+		if !a.note.EditedTime().Equal(b.note.EditedTime()) {
+			return a.note.EditedTime().Before(b.note.EditedTime())
+		}
+		return a.path < b.path
+	})
+	var changed []file
+	current := make(map[string]bool) // paths written this run, never removed as another note's old path
+	for _, f := range w.files {
+		current[f.path] = true
+	}
+	for _, f := range w.files {
+		moved := index[f.note.ID()] != "" && index[f.note.ID()] != f.path
+		hash, ok := committed[f.path]
+		if !moved && ok && hash == blobHash(f.data) {
+			continue
+		}
+		changed = append(changed, f)
+	}
+	w.files = nil
+	if w.Writer.Plan != nil {
+		for _, f := range changed {
+			w.Writer.Plan.AddFile(w.Writer.Name, filepath.Join(w.RepoDir, filepath.FromSlash(f.path)), f.note)
+		}
+		return nil
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	state := &repoState{index: index, committed: committed, current: current}
+	for _, f := range changed {
+		err := ctx.Err()
+		if err == nil {
+			if err = w.commit(worktree, f, author, state); err != nil {
+				err = fmt.Errorf("error committing %s: %v", f.path, err)
+			}
+		}
+		if err != nil {
+			// keep track of the notes committed so far, the next run picks up from there
+			if indexErr := w.saveIndex(index); indexErr != nil {
+				glog.Errorf("error saving git note index: %v", indexErr)
+			}
+			return err
+		}
+	}
+	return w.saveIndex(index)
+}
+
+type repoState struct {
+	index     map[string]string        // note ID to path
+	committed map[string]plumbing.Hash // path to blob in the latest commit
+	current   map[string]bool          // paths written this run
+}
+
+// commit writes a single note to the worktree and commits it, along with removing its old file if it moved.
+func (w *Writer) commit(worktree *git.Worktree, f file, author *mail.Address, state *repoState) error {
+	index, committed := state.index, state.committed
+	id := f.note.ID()
+	destination := filepath.Join(w.RepoDir, filepath.FromSlash(f.path))
+	if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+		return err
+	}
+	if err := keep.WriteFileAtomic(destination, []byte(f.data)); err != nil {
+		return err
+	}
+	if err := worktree.AddWithOptions(&git.AddOptions{Path: f.path, SkipStatus: true}); err != nil {
+		return err
+	}
+	action := "Update"
+	if _, ok := committed[f.path]; !ok {
+		action = "Add"
+	}
+	if old := index[id]; old != "" && old != f.path {
+		action = "Move"
+		if _, ok := committed[old]; ok && !state.current[old] {
+			if _, err := worktree.Remove(old); err != nil {
+				return err
+			}
+			delete(committed, old)
+		}
+	}
+
+	edited := f.note.EditedTime()
+	authored := edited
+	if action == "Add" && f.note.CreatedMicros != nil {
+		authored = f.note.CreatedMicros.Time()
+	}
+	message := fmt.Sprintf("%s %s\n\nNote: %s\n", action, f.note.Title, id)
+	if _, err := worktree.Commit(message, &git.CommitOptions{
+		Author:    &object.Signature{Name: author.Name, Email: author.Address, When: authored},
+		Committer: &object.Signature{Name: author.Name, Email: author.Address, When: edited},
+	}); err != nil {
+		return err
+	}
+	committed[f.path] = blobHash(f.data)
+	index[id] = f.path
+	return nil
+}
+
+func (w *Writer) author() string {
+	if w.Author == "" {
+		return DefaultAuthor
+	}
+	return w.Author
+}
+
+// open opens the repo, initialising it first if there isn't one yet.
+// A dry run never creates the repo, it is treated as empty.
+func (w *Writer) open() (*git.Repository, error) {
+	repo, err := git.PlainOpen(w.RepoDir)
+	if !errors.Is(err, git.ErrRepositoryNotExists) {
+		return repo, err
+	}
+	if w.Writer.Plan != nil {
+		return nil, nil
+	}
+	if err := os.MkdirAll(w.RepoDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return git.PlainInit(w.RepoDir, false)
+}
+
+// headFiles lists the blob of every file in the latest commit, empty for a new repo.
+func headFiles(repo *git.Repository) (map[string]plumbing.Hash, error) {
+	files := make(map[string]plumbing.Hash)
+	if repo == nil {
+		return files, nil
+	}
+	head, err := repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		files[f.Name] = f.Hash
+		return nil
+	})
+	return files, err
+}
+
+func blobHash(data string) plumbing.Hash {
+	return plumbing.ComputeHash(plumbing.BlobObject, []byte(data))
+}
+
+func (w *Writer) loadIndex() (map[string]string, error) {
+	index := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(w.RepoDir, git.GitDirName, indexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("error parsing git note index: %v", err)
+	}
+	return index, nil
+}
+
+func (w *Writer) saveIndex(index map[string]string) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return keep.WriteFileAtomic(filepath.Join(w.RepoDir, git.GitDirName, indexFile), data)
+}
+
+func (w *Writer) Name() string { return w.Writer.Name }
+
+var _ keep.NoteWriter = (*Writer)(nil)
@@ -1,6 +1,7 @@
 package md
 
 import (
+	"context"
 	"strings"
 
 	"path/filepath"
@@ -15,17 +16,21 @@ type Writer struct {
 	Writer    *keep.FileWriter
 	Generator *keep.FileNameGenerator
 	OutDir    string
+	Routing   string // how archived and trashed notes are written, see keep.RouteSplit
+	// DateLayout is the layout of the created and edited dates, see loader.Layout.
+	DateLayout string
 }
 
-func (w *Writer) note2Md(n *loader.Note) (string, error) {
+// Note2Md renders the full note as it is written to markdown files, dates use dateLayout (see loader.Layout).
+func Note2Md(n *loader.Note, dateLayout string) (string, error) {
 	tmpl, err := template.New("text_file").Parse(`
 {{- define "ListCheck"}}[{{if .IsChecked}}x{{else}} {{end}}]{{end -}}
 {{- define "ListEntry"}} - {{template "ListCheck" .}} {{.Text}}{{end -}}
 {{- /* start of file */ -}}
-# {{.Title}}{{- with .CreatedMicros}} - [[{{.}}]]
-Created: [[{{.}}]]{{end}}
+# {{.Title}}{{- with .CreatedMicros}} - [[{{.Format $.DateLayout}}]]
+Created: [[{{.Format $.DateLayout}}]]{{end}}
 {{- with .EditedMicros}}
-Last Edited: {{.}}{{end}}
+Last Edited: {{.Format $.DateLayout}}{{end}}
 
 {{with .TextContent}}{{.}}
 {{end}}
@@ -43,24 +48,30 @@ Last Edited: {{.}}{{end}}
 	}
 
 	sb := strings.Builder{}
-	if err := tmpl.Execute(&sb, n); err != nil {
+	if err := tmpl.Execute(&sb, struct {
+		*loader.Note
+		DateLayout string
+	}{n, dateLayout}); err != nil {
 		return "", err
 	}
 	return sb.String(), nil
 }
-func (w *Writer) WriteNote(n *loader.Note) error {
-	fileName := w.Generator.GenerateAndReserve(n)
+func (w *Writer) WriteNote(_ context.Context, n *loader.Note) error {
+	n = keep.RouteNote(n, w.Routing)
+	fileName := w.Generator.GenerateAndReserve(n, keep.RoutedFolder(n, w.Routing))
 	filePath, err := filepath.Abs(filepath.Join(w.OutDir, fileName+".md"))
 	if err != nil {
 		return err
 	}
-	md, err := w.note2Md(n)
+	md, err := Note2Md(n, w.DateLayout)
 	if err != nil {
 		return err
 	}
-	return w.Writer.WriteFile(md, filePath)
+	return w.Writer.WriteFile(md, filePath, n)
 }
 
-func (w *Writer) Flush() error {return nil }
+func (w *Writer) Flush(_ context.Context) error {return nil }
+
+func (w *Writer) Name() string { return w.Writer.Name }
 
 var _ keep.NoteWriter = (*Writer)(nil)
\ No newline at end of file
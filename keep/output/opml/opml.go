@@ -1,6 +1,7 @@
 package opml
 
 import (
+	"context"
 	"strings"
 	"sync"
 
@@ -15,6 +16,7 @@ import (
 type Builder struct {
 	OutputFile string
 	Writer    *keep.FileWriter
+	Routing   string // how archived and trashed notes are written, split puts them in their own branches
 	
 	mu        sync.RWMutex
 	notes     []*loader.Note
@@ -22,9 +24,9 @@ type Builder struct {
 	done      chan bool
 }
 
-func (b *Builder) WriteNote(note *loader.Note) error {
+func (b *Builder) WriteNote(_ context.Context, note *loader.Note) error {
 	b.mu.Lock()
-	b.notes = append(b.notes, note)
+	b.notes = append(b.notes, keep.RouteNote(note, b.Routing))
 	b.mu.Unlock()
 	return nil
 }
@@ -37,8 +39,17 @@ func (b *Builder) ToOPML() (string, error) {
 			return sb.String()
 		},
 	}).Parse(`
-{{- define "DynoDate"}}!({{.}}){{end -}}
+{{- define "DynoDate"}}!({{.Format "2006-01-02"}}){{end -}}
 {{- define "TagList"}}{{range .}} #{{.Name}}{{end}}{{end -}}
+{{- define "Notes"}}{{range .}}
+        <outline text="{{.Title | escapeXML}}" _note="{{template "DynoDate" .CreatedMicros}}{{template "TagList" .Labels}}">
+		{{- with .TextContent}}
+            <outline text="---" _note="{{. | escapeXML}}"/>
+		{{- end}}
+		{{- with .ListContent}}{{range .}}
+            <outline text="{{.Text | escapeXML}}"{{if .IsChecked}} complete="true"{{end}}/>{{end}}
+		{{- end}}
+{{- end}}{{end -}}
 {{- /* start of file */ -}}
 <?xml version="1.0" encoding="utf-8"?>
 <opml version="2.0">
@@ -50,16 +61,18 @@ func (b *Builder) ToOPML() (string, error) {
   </head>
   <body>
     <outline text="Google Keep Export">
-{{- range . }}
-        <outline text="{{.Title | escapeXML}}" _note="{{template "DynoDate" .CreatedMicros}}{{template "TagList" .Labels}}">
-		{{- with .TextContent}}
-            <outline text="---" _note="{{. | escapeXML}}"/>
-		{{- end}}
-		{{- with .ListContent}}{{range .}}
-            <outline text="{{.Text | escapeXML}}"{{if .IsChecked}} complete="true"{{end}}/>{{end}}
-		{{- end}}
-{{- end}} {{/* end of notes range */}}
+{{- template "Notes" .Active}}
     </outline>
+{{- with .Archived}}
+    <outline text="Archived">
+{{- template "Notes" .}}
+    </outline>
+{{- end}}
+{{- with .Trashed}}
+    <outline text="Trashed">
+{{- template "Notes" .}}
+    </outline>
+{{- end}}
   </body>
 </opml>
 
@@ -71,18 +84,39 @@ func (b *Builder) ToOPML() (string, error) {
 
 	b.mu.RLock()
 	defer b.mu.RUnlock()
+	// notes arrive in whatever order the writers ran, sort so the output is stable between runs
+	notes := append([]*loader.Note(nil), b.notes...)
+	keep.SortPinnedFirst(notes)
+	var branches struct{ Active, Archived, Trashed []*loader.Note }
+	for _, n := range notes {
+		switch {
+		case b.Routing != keep.RouteSplit || n.State() == loader.StateActive:
+			branches.Active = append(branches.Active, n)
+		case n.State() == loader.StateArchived:
+			branches.Archived = append(branches.Archived, n)
+		default:
+			branches.Trashed = append(branches.Trashed, n)
+		}
+	}
 	sb := strings.Builder{}
-	if err := tmpl.Execute(&sb, b.notes); err != nil {
+	if err := tmpl.Execute(&sb, branches); err != nil {
 		return "", err
 	}
 	return sb.String(), nil
 }
-func (b *Builder) Flush() error {
+func (b *Builder) Flush(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	ompl, err := b.ToOPML()
 	if err != nil {
 		return err
 	}
-	return b.Writer.WriteFile(ompl, b.OutputFile)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.Writer.WriteFile(ompl, b.OutputFile, b.notes...)
 }
 
+func (b *Builder) Name() string { return b.Writer.Name }
+
 var _ keep.NoteWriter = (*Builder)(nil)
\ No newline at end of file
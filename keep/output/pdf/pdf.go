@@ -1,7 +1,10 @@
 package pdf
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"sort"
 	"sync"
 
 	"codeberg.org/go-pdf/fpdf"
@@ -12,69 +15,151 @@ import (
 	"github.com/dragon1672/go-keep-export-to-text/keep/output/text"
 )
 
-// Builder buffers notes in memory then writes to a single file.
+// DefaultWordLimit is the most words NotebookLM accepts per source.
+const DefaultWordLimit = 500000
+
+// filePrefixes name the PDFs for each state when split, active notes go to out_N.pdf.
+var filePrefixes = map[string]string{
+	loader.StateActive:   "out",
+	loader.StateArchived: "archived",
+	loader.StateTrashed:  "trashed",
+}
+
+// page is a note rendered ready to be added to a PDF.
+type page struct {
+	note                   *loader.Note
+	title, subheader, body string
+	wordCount              int
+}
+
+// Builder buffers notes in memory then writes them to PDFs of up to WordLimit words on Flush.
+// Notes are buffered rather than written as they arrive so pinned notes can go first.
 type Builder struct {
-	mu        sync.RWMutex
-	currentPDF	   *fpdf.Fpdf
+	mu               sync.Mutex
+	pages            []page
+	currentPDF       *fpdf.Fpdf
 	currentWordCount int
-	outputCnt int
+	currentNotes     []*loader.Note
+	outputCnt        map[string]int // per file prefix
 
 	OutputDir string
 	Writer    *keep.FileWriter
-	WordLimit int
+	WordLimit int    // defaults to DefaultWordLimit
+	Routing   string // how archived and trashed notes are written, split writes them to their own PDFs
+	// DateLayout is the layout of the created and edited dates, see loader.Layout.
+	DateLayout string
 }
 
-func (b *Builder) WriteNote(note *loader.Note) error {
-	title, subheader, body, err := text.Note2TxtParts(note)
+func (b *Builder) WriteNote(_ context.Context, note *loader.Note) error {
+	note = keep.RouteNote(note, b.Routing)
+	title, subheader, body, err := text.Note2TxtParts(note, b.DateLayout)
 	if err != nil {
 		return err
 	}
 
-	wordCount := keep.CountWords(title,subheader,body)
-
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	if b.currentPDF == nil {
-		b.currentPDF = fpdf.New("P", "mm", "A4", "")
-	}
-	if b.currentWordCount + wordCount > b.WordLimit {
+	b.pages = append(b.pages, page{
+		note:      note,
+		title:     title,
+		subheader: subheader,
+		body:      body,
+		wordCount: keep.CountWords(title, subheader, body),
+	})
+	return nil
+}
+
+func (b *Builder) addPage(prefix string, p page) error {
+	if len(b.currentNotes) > 0 && b.currentWordCount+p.wordCount > b.wordLimit() {
 		// Assumption that all notes are similar sizes so no fancy packing algorithm.
 		// Just flush when we hit the limit.
-		if err := b.unlockedFlush(); err != nil {
+		if err := b.flushPDF(prefix); err != nil {
 			return err
 		}
 	}
+	if b.currentPDF == nil { // first page, or the previous PDF was just flushed
+		b.currentPDF = fpdf.New("P", "mm", "A4", "")
+	}
 
 	b.currentPDF.AddPage()
 	b.currentPDF.SetFont("Arial", "B", 14)
-	b.currentPDF.MultiCell(0, 10, title, "", "C", false)
+	b.currentPDF.MultiCell(0, 10, p.title, "", "C", false)
 	b.currentPDF.SetFont("Arial", "I", 10)
-	b.currentPDF.MultiCell(0, 5, subheader, "", "C", false)
+	b.currentPDF.MultiCell(0, 5, p.subheader, "", "C", false)
 	b.currentPDF.Ln(5)
 	b.currentPDF.SetFont("Arial", "", 12)
-	b.currentPDF.MultiCell(0, 5, body, "", "L", false)
-	b.currentWordCount += wordCount
+	b.currentPDF.MultiCell(0, 5, p.body, "", "L", false)
+	b.currentWordCount += p.wordCount
+	b.currentNotes = append(b.currentNotes, p.note)
 	return nil
 }
 
-func (b *Builder) unlockedFlush() error {
-	outFile := fmt.Sprintf("%s/out_%d.pdf", b.OutputDir, b.outputCnt)
-	b.Writer.DirPrep(outFile)
+func (b *Builder) wordLimit() int {
+	if b.WordLimit <= 0 {
+		return DefaultWordLimit
+	}
+	return b.WordLimit
+}
+
+func (b *Builder) flushPDF(prefix string) error {
+	if b.currentPDF == nil {
+		return nil // nothing written
+	}
+	outFile := fmt.Sprintf("%s/%s_%d.pdf", b.OutputDir, prefix, b.outputCnt[prefix])
 	glog.Infof("flushing %d words to PDF to %s", b.currentWordCount, outFile)
-	if err := b.currentPDF.OutputFileAndClose(outFile); err != nil {
+	// Pin the embedded dates to the notes so unchanged chunks produce identical files between runs.
+	newest := keep.NotesTime(b.currentNotes...)
+	b.currentPDF.SetCreationDate(newest)
+	b.currentPDF.SetModificationDate(newest)
+	b.currentPDF.SetCatalogSort(true)
+	buf := bytes.Buffer{}
+	if err := b.currentPDF.Output(&buf); err != nil {
+		return err
+	}
+	if err := b.Writer.WriteFile(buf.String(), outFile, b.currentNotes...); err != nil {
 		return err
 	}
-	b.outputCnt++
-	b.currentPDF = fpdf.New("P", "mm", "A4", "")
+	b.outputCnt[prefix]++
+	b.currentPDF = nil
 	b.currentWordCount = 0
+	b.currentNotes = nil
 	return nil
 }
 
-
-func (b *Builder) Flush() error {
+// Flush writes every buffered note, pinned notes first.
+func (b *Builder) Flush(ctx context.Context) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	return b.unlockedFlush()
+	if b.outputCnt == nil {
+		b.outputCnt = make(map[string]int)
+	}
+	groups := make(map[string][]page)
+	for _, p := range b.pages {
+		state := loader.StateActive
+		if b.Routing == keep.RouteSplit {
+			state = p.note.State()
+		}
+		groups[state] = append(groups[state], p)
+	}
+	for _, state := range []string{loader.StateActive, loader.StateArchived, loader.StateTrashed} {
+		pages := groups[state]
+		sort.SliceStable(pages, func(i, j int) bool { return keep.PinnedFirst(pages[i].note, pages[j].note) })
+		for _, p := range pages {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := b.addPage(filePrefixes[state], p); err != nil {
+				return err
+			}
+		}
+		if err := b.flushPDF(filePrefixes[state]); err != nil {
+			return err
+		}
+	}
+	b.pages = nil
+	return nil
 }
 
-var _ keep.NoteWriter = (*Builder)(nil)
\ No newline at end of file
+func (b *Builder) Name() string { return b.Writer.Name }
+
+var _ keep.NoteWriter = (*Builder)(nil)
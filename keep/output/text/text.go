@@ -1,6 +1,7 @@
 package text
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -15,24 +16,28 @@ type Writer struct {
 	Writer    *keep.FileWriter
 	Generator *keep.FileNameGenerator
 	OutDir    string
+	Routing   string // how archived and trashed notes are written, see keep.RouteSplit
+	// DateLayout is the layout of the created and edited dates, see loader.Layout.
+	DateLayout string
 }
 
-func (w *Writer) Flush() error {return nil }
+func (w *Writer) Flush(_ context.Context) error {return nil }
 
-func note2Txt(n *loader.Note) (string, error) {
-	title, subheader, body, err := Note2TxtParts(n)
+// Note2Txt renders the full note as it is written to text files, dates use dateLayout (see loader.Layout).
+func Note2Txt(n *loader.Note, dateLayout string) (string, error) {
+	title, subheader, body, err := Note2TxtParts(n, dateLayout)
 	if err != nil {
 		return "", err
 	}
 	return fmt.Sprintf("%s\n%s\n\n%s", title, subheader, body), nil
 }
 
-func Note2TxtParts(n *loader.Note) (string, string, string, error) {
+func Note2TxtParts(n *loader.Note, dateLayout string) (string, string, string, error) {
 	title, err := note2TxtTitle(n)
 	if err != nil {
 		return "","","", err
 	}
-	subHeader, err := note2TxtSubHeader(n)
+	subHeader, err := note2TxtSubHeader(n, dateLayout)
 	if err != nil {
 		return "","","", err
 	}
@@ -60,13 +65,13 @@ func note2TxtTitle(n *loader.Note) (string, error) {
 	return strings.Trim(sb.String(), "\n "), nil
 }
 
-func note2TxtSubHeader(n *loader.Note) (string, error) {
+func note2TxtSubHeader(n *loader.Note, dateLayout string) (string, error) {
 	tmpl, err := template.New("text_file").Parse(`
 {{- /* start of file */ -}}
 {{- with .CreatedMicros}}
-Created: {{.}}{{end}}
+Created: {{.Format $.DateLayout}}{{end}}
 {{- with .EditedMicros}}
-Edited: {{.}}{{end}}
+Edited: {{.Format $.DateLayout}}{{end}}
 {{- /* end of file */ -}}
 `)
 	if err != nil {
@@ -74,7 +79,10 @@ Edited: {{.}}{{end}}
 	}
 
 	sb := strings.Builder{}
-	if err := tmpl.Execute(&sb, n); err != nil {
+	if err := tmpl.Execute(&sb, struct {
+		*loader.Note
+		DateLayout string
+	}{n, dateLayout}); err != nil {
 		return "", err
 	}
 	return strings.Trim(sb.String(), "\n "), nil
@@ -106,17 +114,20 @@ func note2TxtBody(n *loader.Note) (string, error) {
 	}
 	return strings.Trim(sb.String(), "\n "), nil
 }
-func (w *Writer) WriteNote(n *loader.Note) error {
-	fileName := w.Generator.GenerateAndReserve(n)
+func (w *Writer) WriteNote(_ context.Context, n *loader.Note) error {
+	n = keep.RouteNote(n, w.Routing)
+	fileName := w.Generator.GenerateAndReserve(n, keep.RoutedFolder(n, w.Routing))
 	filePath, err := filepath.Abs(filepath.Join(w.OutDir, fileName+".txt"))
 	if err != nil {
 		return err
 	}
-	txt, err := note2Txt(n)
+	txt, err := Note2Txt(n, w.DateLayout)
 	if err != nil {
 		return err
 	}
-	return w.Writer.WriteFile(txt, filePath)
+	return w.Writer.WriteFile(txt, filePath, n)
 }
 
+func (w *Writer) Name() string { return w.Writer.Name }
+
 var _ keep.NoteWriter = (*Writer)(nil)
\ No newline at end of file
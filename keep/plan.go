@@ -0,0 +1,107 @@
+package keep
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+)
+
+// Plan records what an export would do without touching the filesystem.
+type Plan struct {
+	mu         sync.Mutex
+	Files      []PlannedFile `json:"files"`
+	Skipped    []PlannedNote `json:"skipped"`
+	Collisions []Collision   `json:"collisions"`
+}
+
+// PlannedFile is a single file a writer would produce.
+type PlannedFile struct {
+	Writer string        `json:"writer"`
+	Path   string        `json:"path"`
+	Notes  []PlannedNote `json:"notes"`
+}
+
+type PlannedNote struct {
+	ID       string `json:"id"`
+	FileName string `json:"file_name"`
+	Title    string `json:"title"`
+	Reason   string `json:"reason,omitempty"` // why the note was skipped
+}
+
+func planNote(n *loader.Note) PlannedNote {
+	return PlannedNote{ID: n.ID(), FileName: n.FileName, Title: n.Title}
+}
+
+func (p *Plan) AddFile(writer string, path string, notes ...*loader.Note) {
+	f := PlannedFile{Writer: writer, Path: path}
+	for _, n := range notes {
+		f.Notes = append(f.Notes, planNote(n))
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Files = append(p.Files, f)
+}
+
+func (p *Plan) AddSkipped(n *loader.Note, reason string) {
+	skipped := planNote(n)
+	skipped.Reason = reason
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Skipped = append(p.Skipped, skipped)
+}
+
+func (p *Plan) AddCollisions(collisions ...Collision) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Collisions = append(p.Collisions, collisions...)
+}
+
+// Sort orders files by writer then path so plans can be diffed between runs.
+func (p *Plan) Sort() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sort.SliceStable(p.Files, func(i, j int) bool {
+		if p.Files[i].Writer != p.Files[j].Writer {
+			return p.Files[i].Writer < p.Files[j].Writer
+		}
+		return p.Files[i].Path < p.Files[j].Path
+	})
+	sort.SliceStable(p.Skipped, func(i, j int) bool { return p.Skipped[i].FileName < p.Skipped[j].FileName })
+}
+
+// Print writes a human-readable version of the plan.
+func (p *Plan) Print(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	writer := ""
+	seen := make(map[string]string) // path -> writer, to flag files written more than once
+	for _, f := range p.Files {
+		if f.Writer != writer {
+			writer = f.Writer
+			fmt.Fprintf(w, "%s:\n", writer)
+		}
+		fmt.Fprintf(w, "  %s\n", f.Path)
+		for _, n := range f.Notes {
+			fmt.Fprintf(w, "    <- %s %s\n", n.ID, n.Title)
+		}
+		if other, ok := seen[f.Path]; ok {
+			fmt.Fprintf(w, "    !! also written by %s\n", other)
+		}
+		seen[f.Path] = f.Writer
+	}
+	if len(p.Collisions) > 0 {
+		fmt.Fprintf(w, "collisions:\n")
+		for _, c := range p.Collisions {
+			fmt.Fprintf(w, "  %s %s -> %s\n", c.NoteID, c.Path, c.ResolvedPath)
+		}
+	}
+	if len(p.Skipped) > 0 {
+		fmt.Fprintf(w, "skipped:\n")
+		for _, n := range p.Skipped {
+			fmt.Fprintf(w, "  %s %s (%s)\n", n.ID, n.FileName, n.Reason)
+		}
+	}
+}
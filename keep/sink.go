@@ -0,0 +1,127 @@
+package keep
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"path/filepath"
+
+	"github.com/golang/glog"
+)
+
+// What to do when a destination file already exists.
+const (
+	OverwriteAlways       = "overwrite"
+	OverwriteSkipExisting = "skip-existing" // leave the existing file alone
+	OverwriteFail         = "fail"          // return an error
+	OverwriteBackup       = "backup"        // move the existing file to `${file}.bak` (or `.bak.N`) first
+	OverwriteSuffix       = "suffix"        // write to `${name} (N).${ext}` instead
+)
+
+// Sink stores the files produced by writers.
+type Sink interface {
+	// Write stores data at destination, returning where it was actually written or "" if it was skipped.
+	// modTime is the time of the notes that produced the file, zero if unknown.
+	Write(destination string, data []byte, modTime time.Time) (string, error)
+	// Close finishes any buffered output, it is called once after every writer has flushed.
+	Close() error
+}
+
+// Renamer is optionally implemented by sinks that store files under a different name than they are given.
+type Renamer interface {
+	Rename(destination string) string
+}
+
+// DirSink writes files directly to the filesystem.
+type DirSink struct {
+	CreateDir  bool
+	Overwrite  string // policy for existing files, defaults to OverwriteAlways
+	SetModTime bool   // set file mtime and atime to the note time instead of now
+}
+
+func (d *DirSink) Write(destination string, data []byte, modTime time.Time) (string, error) {
+	if d.CreateDir {
+		if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+			return "", err
+		}
+	}
+	destination, err := d.resolveExisting(destination)
+	if err != nil || destination == "" {
+		return "", err
+	}
+	if err := WriteFileAtomic(destination, data); err != nil {
+		return "", err
+	}
+	if d.SetModTime && !modTime.IsZero() {
+		if err := os.Chtimes(destination, modTime, modTime); err != nil {
+			return "", err
+		}
+	}
+	return destination, nil
+}
+
+func (d *DirSink) Close() error { return nil }
+
+func exists(destination string) bool {
+	_, err := os.Lstat(destination)
+	return err == nil
+}
+
+// resolveExisting applies the overwrite policy, returning where to write or "" to skip.
+func (d *DirSink) resolveExisting(destination string) (string, error) {
+	if !exists(destination) {
+		return destination, nil
+	}
+	switch d.Overwrite {
+	case "", OverwriteAlways:
+		return destination, nil
+	case OverwriteSkipExisting:
+		glog.Infof("skipping existing file %s", destination)
+		return "", nil
+	case OverwriteFail:
+		return "", fmt.Errorf("refusing to overwrite existing file %s", destination)
+	case OverwriteBackup:
+		backup := destination + ".bak"
+		for i := 1; exists(backup); i++ {
+			backup = fmt.Sprintf("%s.bak.%d", destination, i)
+		}
+		return destination, os.Rename(destination, backup)
+	case OverwriteSuffix:
+		ext := filepath.Ext(destination)
+		base := strings.TrimSuffix(destination, ext)
+		for i := 1; ; i++ {
+			if candidate := fmt.Sprintf("%s (%d)%s", base, i, ext); !exists(candidate) {
+				return candidate, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unknown overwrite policy %q", d.Overwrite)
+}
+
+// WriteFileAtomic writes to a temp file next to destination then renames it into place,
+// so an interrupted run never leaves a truncated file behind.
+func WriteFileAtomic(destination string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(destination), "."+filepath.Base(destination)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), destination)
+}
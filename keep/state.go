@@ -0,0 +1,56 @@
+package keep
+
+import (
+	"sort"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+)
+
+// How writers handle archived and trashed notes.
+const (
+	RouteSplit = "split" // archive/ and trash/ subfolders, separate OPML branches or separate PDFs
+	RouteTag   = "tag"   // mixed in with active notes, labelled archived or trashed
+	RouteNone  = "none"  // mixed in with active notes as is
+)
+
+var stateFolders = map[string]string{
+	loader.StateArchived: "archive",
+	loader.StateTrashed:  "trash",
+}
+
+// StateFolder is the subfolder split routing puts the note in, empty for active notes.
+func StateFolder(n *loader.Note) string {
+	return stateFolders[n.State()]
+}
+
+// RoutedFolder is the subfolder a writer using routing puts the note in, only split routing uses one.
+func RoutedFolder(n *loader.Note, routing string) string {
+	if routing != RouteSplit {
+		return ""
+	}
+	return StateFolder(n)
+}
+
+// RouteNote returns the note as a writer using routing should see it.
+// Tagging works on a copy since the note is shared with other writers.
+func RouteNote(n *loader.Note, routing string) *loader.Note {
+	if routing != RouteTag || n.State() == loader.StateActive {
+		return n
+	}
+	tagged := *n
+	tagged.Labels = append(append([]loader.ListLabel(nil), n.Labels...), loader.ListLabel{Name: n.State()})
+	return &tagged
+}
+
+// PinnedFirst orders notes for combined outputs, pinned notes first then by file name so output is stable.
+func PinnedFirst(a, b *loader.Note) bool {
+	if a.IsPinned != b.IsPinned {
+		return a.IsPinned
+	}
+	return a.FileName < b.FileName
+}
+
+// SortPinnedFirst sorts notes with PinnedFirst.
+func SortPinnedFirst(notes []*loader.Note) {
+	sort.SliceStable(notes, func(i, j int) bool { return PinnedFirst(notes[i], notes[j]) })
+}
@@ -0,0 +1,167 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"html/template"
+)
+
+// heatmap cell size and gap in pixels
+const (
+	cellSize = 11
+	cellGap  = 2
+	cellStep = cellSize + cellGap
+	// room for the month and weekday labels
+	heatmapTop  = 15
+	heatmapLeft = 30
+)
+
+// heatColors go from no notes to the busiest day.
+var heatColors = []string{"#ebedf0", "#9be9a8", "#40c463", "#30a14e", "#216e39"}
+
+type cell struct {
+	X, Y  int
+	Color string
+	Title string
+}
+
+type label struct {
+	X, Y int
+	Text string
+}
+
+// yearHeatmap is one year of the calendar heatmap, a column per week with Monday at the top.
+type yearHeatmap struct {
+	Year          int
+	Width, Height int
+	Cells         []cell
+	Months        []label
+	Weekdays      []label
+}
+
+func heatmaps(perDay map[string]int) []yearHeatmap {
+	busiest := 0
+	years := make(map[int]bool)
+	for day, count := range perDay {
+		busiest = max(busiest, count)
+		if t, err := time.Parse(DayLayout, day); err == nil {
+			years[t.Year()] = true
+		}
+	}
+	var sorted []int
+	for y := range years {
+		sorted = append(sorted, y)
+	}
+	sort.Ints(sorted)
+
+	var maps []yearHeatmap
+	for _, year := range sorted {
+		first := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		offset := (int(first.Weekday()) + 6) % 7 // days since the Monday starting the first column
+		h := yearHeatmap{Year: year}
+		for day := first; day.Year() == year; day = day.AddDate(0, 0, 1) {
+			index := day.YearDay() - 1 + offset
+			week, weekday := index/7, index%7
+			count := perDay[day.Format(DayLayout)]
+			level := 0
+			if count > 0 {
+				level = (count*(len(heatColors)-1) + busiest - 1) / busiest // 1 to 4
+			}
+			x, y := heatmapLeft+week*cellStep, heatmapTop+weekday*cellStep
+			h.Cells = append(h.Cells, cell{
+				X:     x,
+				Y:     y,
+				Color: heatColors[level],
+				Title: fmt.Sprintf("%s: %d notes", day.Format(DayLayout), count),
+			})
+			if day.Day() == 1 {
+				h.Months = append(h.Months, label{X: x, Y: heatmapTop - 4, Text: day.Format("Jan")})
+			}
+			h.Width = max(h.Width, x+cellSize)
+			h.Height = max(h.Height, y+cellSize)
+		}
+		for i, name := range []string{"Mon", "Wed", "Fri"} {
+			h.Weekdays = append(h.Weekdays, label{X: 0, Y: heatmapTop + (i*2)*cellStep + cellSize - 1, Text: name})
+		}
+		maps = append(maps, h)
+	}
+	return maps
+}
+
+var htmlReport = template.Must(template.New("stats").Funcs(template.FuncMap{"percent": percent}).Parse(`
+{{- define "counts"}}<table>{{range .}}<tr><td>{{.Key}}</td><td class="n">{{.Count}}</td></tr>{{end}}</table>{{end}}
+{{- define "notes"}}<table>{{range .}}<tr><td>{{.Title}}</td><td>{{.Created}}</td><td class="n">{{.Words}} words</td></tr>{{end}}</table>{{end -}}
+<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Keep Stats</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #24292f; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+td, th { padding: 2px 12px 2px 0; text-align: left; }
+td.n { text-align: right; }
+svg text { font-size: 9px; fill: #57606a; }
+section { display: inline-block; vertical-align: top; margin-right: 3em; }
+</style>
+</head>
+<body>
+<h1>Keep Stats</h1>
+
+<h2>Notes created per day</h2>
+{{range .Heatmaps}}
+<h3>{{.Year}}</h3>
+<svg width="{{.Width}}" height="{{.Height}}">
+{{- range .Months}}<text x="{{.X}}" y="{{.Y}}">{{.Text}}</text>{{end}}
+{{- range .Weekdays}}<text x="{{.X}}" y="{{.Y}}">{{.Text}}</text>{{end}}
+{{- range .Cells}}
+<rect x="{{.X}}" y="{{.Y}}" width="{{$.CellSize}}" height="{{$.CellSize}}" rx="2" fill="{{.Color}}"><title>{{.Title}}</title></rect>
+{{- end}}
+</svg>
+{{end}}
+
+{{with .Stats}}
+<section>
+<h2>Summary</h2>
+<table>
+<tr><td>notes</td><td class="n">{{.Notes}}</td></tr>
+<tr><td>text notes</td><td class="n">{{.TextNotes}}</td></tr>
+<tr><td>list notes</td><td class="n">{{.ListNotes}}</td></tr>
+<tr><td>list items</td><td class="n">{{.ListItems}}</td></tr>
+<tr><td>checked items</td><td class="n">{{.CheckedItems}} ({{percent .ItemsCompletion}})</td></tr>
+<tr><td>completed lists</td><td class="n">{{.CompletedLists}}</td></tr>
+<tr><td>average list checked</td><td class="n">{{percent .ListCompletion}}</td></tr>
+<tr><td>words</td><td class="n">{{.Words}}</td></tr>
+<tr><td>words per note</td><td class="n">{{printf "%.1f" .AverageWords}}</td></tr>
+<tr><td>unlabeled notes</td><td class="n">{{.Unlabeled}}</td></tr>
+<tr><td>never edited</td><td class="n">{{len .NeverEdited}}</td></tr>
+<tr><td>first created</td><td class="n">{{.FirstCreated}}</td></tr>
+<tr><td>last created</td><td class="n">{{.LastCreated}}</td></tr>
+</table>
+</section>
+
+<section><h2>Per year</h2>{{template "counts" .PerYear}}</section>
+<section><h2>Per weekday</h2>{{template "counts" .PerWeekday}}</section>
+<section><h2>Per month</h2>{{template "counts" .PerMonth}}</section>
+<section><h2>Colors</h2>{{template "counts" .Colors}}</section>
+<section><h2>Labels</h2>{{template "counts" .Labels}}</section>
+<section><h2>Labels used together</h2>{{template "counts" .LabelPairs}}</section>
+<section><h2>Longest</h2>{{template "notes" .Longest}}</section>
+<section><h2>Oldest</h2>{{template "notes" .Oldest}}</section>
+<section><h2>Never edited</h2>{{template "notes" .NeverEdited}}</section>
+{{end}}
+</body>
+</html>
+`))
+
+// PrintHTML writes a standalone HTML report with an SVG calendar heatmap of notes created per day.
+func (s *Stats) PrintHTML(w io.Writer) error {
+	return htmlReport.Execute(w, struct {
+		Stats    *Stats
+		Heatmaps []yearHeatmap
+		CellSize int
+	}{s, heatmaps(s.PerDay), cellSize})
+}
@@ -0,0 +1,293 @@
+// Package stats summarises notes: activity over time, labels, checklists, lengths and colors.
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"encoding/json"
+	"text/tabwriter"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep"
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+)
+
+// topN is how many notes are listed as the longest and oldest.
+const topN = 5
+
+// editSlack is how long after creation an edit still counts as writing the note, Keep keeps saving while typing.
+const editSlack = time.Minute
+
+// DayLayout keys PerDay.
+const DayLayout = "2006-01-02"
+
+// Count is a key with how often it was seen.
+type Count struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// NoteSummary identifies a note in the stats.
+type NoteSummary struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Created string `json:"created"`
+	Words   int    `json:"words"`
+}
+
+// Stats summarise a set of notes, activity is counted by created time.
+type Stats struct {
+	Notes     int `json:"notes"`
+	TextNotes int `json:"text_notes"`
+	ListNotes int `json:"list_notes"`
+
+	Words        int           `json:"words"`
+	AverageWords float64       `json:"average_words"`
+	Longest      []NoteSummary `json:"longest"`
+	Oldest       []NoteSummary `json:"oldest"`
+
+	FirstCreated string        `json:"first_created,omitempty"`
+	LastCreated  string        `json:"last_created,omitempty"`
+	NeverEdited  []NoteSummary `json:"never_edited"` // not edited after they were first written
+
+	PerYear    []Count        `json:"per_year"`
+	PerMonth   []Count        `json:"per_month"`   // YYYY-MM
+	PerWeekday []Count        `json:"per_weekday"` // Monday first
+	PerDay     map[string]int `json:"per_day"`     // DayLayout
+
+	Labels          []Count `json:"labels"`      // most used first
+	LabelPairs      []Count `json:"label_pairs"` // labels used together on a note, as `a + b`
+	Unlabeled       int     `json:"unlabeled"`
+	ListItems       int     `json:"list_items"`
+	CheckedItems    int     `json:"checked_items"`
+	ItemsCompletion float64 `json:"items_completion"` // checked items over all items
+	CompletedLists  int     `json:"completed_lists"`  // every item checked
+	ListCompletion  float64 `json:"list_completion"`  // average of each list's checked items over its items
+
+	Colors []Count `json:"colors"`
+}
+
+type summary struct {
+	note  *loader.Note
+	words int
+}
+
+func (s summary) export() NoteSummary {
+	ns := NoteSummary{ID: s.note.ID(), Title: s.note.Title, Words: s.words}
+	if s.note.CreatedMicros != nil {
+		ns.Created = s.note.CreatedMicros.String()
+	}
+	return ns
+}
+
+// Compute summarises notes, ignoredLabels (eg: default tags added to every note) aren't counted.
+func Compute(notes []*loader.Note, ignoredLabels ...string) *Stats {
+	s := &Stats{Notes: len(notes), PerDay: make(map[string]int)}
+	years, months := make(map[string]int), make(map[string]int)
+	weekdays := make([]int, 7)
+	labels, pairs, colors := make(map[string]int), make(map[string]int), make(map[string]int)
+	ignored := make(map[string]bool)
+	for _, l := range ignoredLabels {
+		ignored[strings.ToLower(l)] = true
+	}
+
+	var summaries []summary
+	var listCompletion float64
+	for _, n := range notes {
+		words := keep.CountWords(n.Title, n.TextContent)
+		for _, item := range n.ListContent {
+			words += keep.CountWords(item.Text)
+		}
+		s.Words += words
+		summaries = append(summaries, summary{note: n, words: words})
+
+		if n.TextContent != "" {
+			s.TextNotes++
+		}
+		if len(n.ListContent) > 0 {
+			s.ListNotes++
+			checked := 0
+			for _, item := range n.ListContent {
+				if item.IsChecked {
+					checked++
+				}
+			}
+			s.ListItems += len(n.ListContent)
+			s.CheckedItems += checked
+			if checked == len(n.ListContent) {
+				s.CompletedLists++
+			}
+			listCompletion += float64(checked) / float64(len(n.ListContent))
+		}
+
+		var names []string
+		for _, l := range n.Labels {
+			if !ignored[strings.ToLower(l.Name)] {
+				names = append(names, l.Name)
+				labels[l.Name]++
+			}
+		}
+		if len(names) == 0 {
+			s.Unlabeled++
+		}
+		sort.Strings(names)
+		for i := range names {
+			for j := i + 1; j < len(names); j++ {
+				pairs[names[i]+" + "+names[j]]++
+			}
+		}
+
+		color := n.Color
+		if color == "" {
+			color = "DEFAULT"
+		}
+		colors[color]++
+
+		if n.CreatedMicros != nil {
+			created := n.CreatedMicros.Time()
+			years[created.Format("2006")]++
+			months[created.Format("2006-01")]++
+			weekdays[(created.Weekday()+6)%7]++ // Monday first
+			s.PerDay[created.Format(DayLayout)]++
+			if n.EditedMicros == nil || n.EditedMicros.Time().Sub(created) <= editSlack {
+				s.NeverEdited = append(s.NeverEdited, summary{note: n, words: words}.export())
+			}
+		}
+	}
+
+	if s.Notes > 0 {
+		s.AverageWords = float64(s.Words) / float64(s.Notes)
+	}
+	if s.ListItems > 0 {
+		s.ItemsCompletion = float64(s.CheckedItems) / float64(s.ListItems)
+	}
+	if s.ListNotes > 0 {
+		s.ListCompletion = listCompletion / float64(s.ListNotes)
+	}
+	s.PerYear = byKey(years)
+	s.PerMonth = byKey(months)
+	for i, count := range weekdays {
+		s.PerWeekday = append(s.PerWeekday, Count{Key: time.Weekday((i + 1) % 7).String(), Count: count})
+	}
+	s.Labels = byCount(labels)
+	s.LabelPairs = byCount(pairs)
+	s.Colors = byCount(colors)
+
+	sort.SliceStable(summaries, func(i, j int) bool { return summaries[i].words > summaries[j].words })
+	for _, sm := range summaries[:min(topN, len(summaries))] {
+		s.Longest = append(s.Longest, sm.export())
+	}
+	var dated []summary
+	for _, sm := range summaries {
+		if sm.note.CreatedMicros != nil {
+			dated = append(dated, sm)
+		}
+	}
+	sort.SliceStable(dated, func(i, j int) bool {
+		return dated[i].note.CreatedMicros.Time().Before(dated[j].note.CreatedMicros.Time())
+	})
+	for _, sm := range dated[:min(topN, len(dated))] {
+		s.Oldest = append(s.Oldest, sm.export())
+	}
+	if len(dated) > 0 {
+		s.FirstCreated = dated[0].note.CreatedMicros.String()
+		s.LastCreated = dated[len(dated)-1].note.CreatedMicros.String()
+	}
+	return s
+}
+
+func byKey(m map[string]int) []Count {
+	counts := make([]Count, 0, len(m))
+	for k, v := range m {
+		counts = append(counts, Count{Key: k, Count: v})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Key < counts[j].Key })
+	return counts
+}
+
+func byCount(m map[string]int) []Count {
+	counts := byKey(m)
+	sort.SliceStable(counts, func(i, j int) bool { return counts[i].Count > counts[j].Count })
+	return counts
+}
+
+func percent(f float64) string {
+	return fmt.Sprintf("%.1f%%", f*100)
+}
+
+func (s *Stats) PrintJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(s)
+}
+
+// PrintTable writes a human-readable summary, long lists are cut to their top entries.
+func (s *Stats) PrintTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "notes\t%d\n", s.Notes)
+	fmt.Fprintf(tw, "text notes\t%d\n", s.TextNotes)
+	fmt.Fprintf(tw, "list notes\t%d\n", s.ListNotes)
+	fmt.Fprintf(tw, "list items\t%d (%d checked, %s)\n", s.ListItems, s.CheckedItems, percent(s.ItemsCompletion))
+	fmt.Fprintf(tw, "completed lists\t%d (average list %s checked)\n", s.CompletedLists, percent(s.ListCompletion))
+	fmt.Fprintf(tw, "labels\t%d (%d notes unlabeled)\n", len(s.Labels), s.Unlabeled)
+	fmt.Fprintf(tw, "words\t%d (%.1f per note)\n", s.Words, s.AverageWords)
+	if s.FirstCreated != "" {
+		fmt.Fprintf(tw, "first created\t%s\n", s.FirstCreated)
+		fmt.Fprintf(tw, "last created\t%s\n", s.LastCreated)
+	}
+	fmt.Fprintf(tw, "never edited\t%d\n", len(s.NeverEdited))
+
+	section := func(name string, counts []Count, limit int) {
+		if len(counts) == 0 {
+			return
+		}
+		fmt.Fprintf(tw, "\n%s\t\n", name)
+		for i, c := range counts {
+			if limit > 0 && i == limit {
+				fmt.Fprintf(tw, "  ...\t%d more\n", len(counts)-limit)
+				break
+			}
+			fmt.Fprintf(tw, "  %s\t%d\n", c.Key, c.Count)
+		}
+	}
+	// recent lists the last counts, for sections in date order where recent activity matters most
+	recent := func(name string, counts []Count, limit int) {
+		if len(counts) == 0 {
+			return
+		}
+		fmt.Fprintf(tw, "\n%s\t\n", name)
+		if len(counts) > limit {
+			fmt.Fprintf(tw, "  ...\t%d earlier\n", len(counts)-limit)
+			counts = counts[len(counts)-limit:]
+		}
+		for _, c := range counts {
+			fmt.Fprintf(tw, "  %s\t%d\n", c.Key, c.Count)
+		}
+	}
+	notes := func(name string, summaries []NoteSummary, limit int) {
+		if len(summaries) == 0 {
+			return
+		}
+		fmt.Fprintf(tw, "\n%s\t\n", name)
+		for i, n := range summaries {
+			if limit > 0 && i == limit {
+				fmt.Fprintf(tw, "  ...\t%d more\n", len(summaries)-limit)
+				break
+			}
+			fmt.Fprintf(tw, "  %s %s\t%s, %d words\n", n.ID, n.Title, n.Created, n.Words)
+		}
+	}
+	section("per year", s.PerYear, 0)
+	recent("per month", s.PerMonth, 10)
+	section("per weekday", s.PerWeekday, 0)
+	section("labels", s.Labels, 10)
+	section("labels used together", s.LabelPairs, 10)
+	section("colors", s.Colors, 0)
+	notes("longest", s.Longest, 0)
+	notes("oldest", s.Oldest, 0)
+	notes("never edited", s.NeverEdited, 10)
+	return tw.Flush()
+}
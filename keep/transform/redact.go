@@ -0,0 +1,277 @@
+package transform
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"encoding/json"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep"
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+)
+
+// TypeRedact is the redaction transformer.
+const TypeRedact = "redact"
+
+// Built in redaction types, custom patterns use their own name.
+const (
+	RedactPassword = "password"
+	RedactEmail    = "email"
+	RedactCard     = "card"
+	RedactPhone    = "phone"
+	RedactWord     = "word"
+)
+
+// DefaultRedactTypes are the built in detectors used when none are listed.
+var DefaultRedactTypes = []string{RedactPassword, RedactEmail, RedactCard, RedactPhone}
+
+var (
+	// only the value after the keyword is redacted so the note still reads naturally
+	passwordRe = regexp.MustCompile(`(?i)\b(password|passwd|passcode|pwd|pin)(\s*[:=]\s*|\s+is\s+)(\S+)`)
+	emailRe    = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}\b`)
+	cardRe     = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	phoneRe    = regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,4}\)|\b\d{2,4})[\s.-]?\d{3,4}[\s.-]?\d{3,4}\b`)
+)
+
+// RedactPattern is a user supplied regex, matches are replaced with [REDACTED:NAME].
+type RedactPattern struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// RedactOptions configure a Redactor.
+type RedactOptions struct {
+	Types        []string        `json:"types,omitempty"`         // built in detectors, defaults to DefaultRedactTypes
+	Patterns     []RedactPattern `json:"patterns,omitempty"`      // extra regexes
+	PatternsFile string          `json:"patterns_file,omitempty"` // a JSON list of patterns, added to Patterns
+	Words        []string        `json:"words,omitempty"`         // whole words to redact, ignoring case
+	WordsFile    string          `json:"words_file,omitempty"`    // one word or phrase per line, added to Words
+	LogFile      string          `json:"log_file,omitempty"`      // optional JSON log of every redaction, this contains the redacted text
+}
+
+// Redaction is a single redacted value, the log is only ever written locally since it holds the original text.
+type Redaction struct {
+	NoteID   string `json:"note_id"`
+	FileName string `json:"file_name"`
+	Field    string `json:"field"` // title, text, list[N] or file_name
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+}
+
+type detector struct {
+	name    string
+	re      *regexp.Regexp
+	group   int                     // submatch to redact, 0 for the whole match
+	isMatch func(match string) bool // optional extra check
+}
+
+// Redactor replaces sensitive text in titles, bodies and list items with typed placeholders, eg: [REDACTED:EMAIL].
+type Redactor struct {
+	detectors []detector
+	logFile   string
+
+	mu  sync.Mutex
+	log []Redaction
+}
+
+// NewRedactor builds a Redactor, reading the pattern and word files if they are set.
+func NewRedactor(opts RedactOptions) (*Redactor, error) {
+	r := &Redactor{logFile: opts.LogFile}
+	// user patterns go first so their names win over the looser built in detectors
+	patterns := append([]RedactPattern(nil), opts.Patterns...)
+	if opts.PatternsFile != "" {
+		data, err := os.ReadFile(opts.PatternsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading redaction patterns: %v", err)
+		}
+		var filePatterns []RedactPattern
+		if err := json.Unmarshal(data, &filePatterns); err != nil {
+			return nil, fmt.Errorf("error parsing redaction patterns %s: %v", opts.PatternsFile, err)
+		}
+		patterns = append(patterns, filePatterns...)
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling redaction pattern %q: %v", p.Name, err)
+		}
+		name := p.Name
+		if name == "" {
+			name = "custom"
+		}
+		r.detectors = append(r.detectors, detector{name: name, re: re})
+	}
+
+	types := opts.Types
+	if len(types) == 0 {
+		types = DefaultRedactTypes
+	}
+	for _, t := range types {
+		switch t {
+		case RedactPassword:
+			r.detectors = append(r.detectors, detector{name: t, re: passwordRe, group: 3})
+		case RedactEmail:
+			r.detectors = append(r.detectors, detector{name: t, re: emailRe})
+		case RedactCard:
+			r.detectors = append(r.detectors, detector{name: t, re: cardRe, isMatch: luhn})
+		case RedactPhone:
+			r.detectors = append(r.detectors, detector{name: t, re: phoneRe})
+		default:
+			return nil, fmt.Errorf("unknown redaction type %q, expected one of %s", t, strings.Join(DefaultRedactTypes, ", "))
+		}
+	}
+
+	words := append([]string(nil), opts.Words...)
+	if opts.WordsFile != "" {
+		fileWords, err := readLines(opts.WordsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading redaction words: %v", err)
+		}
+		words = append(words, fileWords...)
+	}
+	if len(words) > 0 {
+		quoted := make([]string, len(words))
+		for i, w := range words {
+			quoted[i] = regexp.QuoteMeta(w)
+		}
+		re := regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+		r.detectors = append(r.detectors, detector{name: RedactWord, re: re})
+	}
+	return r, nil
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// luhn checks the card number checksum, which rules out most long numbers that aren't cards.
+func luhn(s string) bool {
+	sum, double, digits := 0, false, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+// Placeholder is what values of the redaction type are replaced with.
+func Placeholder(typ string) string {
+	return fmt.Sprintf("[REDACTED:%s]", strings.ToUpper(typ))
+}
+
+func (r *Redactor) redact(s string, record func(typ, value string)) string {
+	for _, d := range r.detectors {
+		s = replaceSubmatch(d.re, s, d.group, func(match string) (string, bool) {
+			if d.isMatch != nil && !d.isMatch(match) {
+				return match, false
+			}
+			record(d.name, match)
+			return Placeholder(d.name), true
+		})
+	}
+	return s
+}
+
+// replaceSubmatch replaces the group of every match with the result of fun.
+func replaceSubmatch(re *regexp.Regexp, s string, group int, fun func(string) (string, bool)) string {
+	var sb strings.Builder
+	last, replaced := 0, false
+	for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := m[2*group], m[2*group+1]
+		if start < 0 {
+			continue
+		}
+		replacement, ok := fun(s[start:end])
+		if !ok {
+			continue
+		}
+		sb.WriteString(s[last:start])
+		sb.WriteString(replacement)
+		last, replaced = end, true
+	}
+	if !replaced {
+		return s
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+// Transform redacts the note in place. The file name is redacted too as takeouts name files after the title,
+// hits are logged against the original id and file name.
+func (r *Redactor) Transform(_ context.Context, n *loader.Note) error {
+	var found []Redaction
+	id, fileName := n.ID(), n.FileName
+	field := func(name string) func(typ, value string) {
+		return func(typ, value string) {
+			found = append(found, Redaction{NoteID: id, FileName: fileName, Field: name, Type: typ, Value: value})
+		}
+	}
+	n.Title = r.redact(n.Title, field("title"))
+	n.ExtractedTitle = r.redact(n.ExtractedTitle, func(string, string) {}) // same text as the title, logged there
+	n.TextContent = r.redact(n.TextContent, field("text"))
+	for i := range n.ListContent {
+		n.ListContent[i].Text = r.redact(n.ListContent[i].Text, field(fmt.Sprintf("list[%d]", i)))
+	}
+	n.FileName = r.redact(n.FileName, field("file_name"))
+	if len(found) > 0 {
+		r.mu.Lock()
+		r.log = append(r.log, found...)
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+// Log lists every redaction made so far.
+func (r *Redactor) Log() []Redaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Redaction(nil), r.log...)
+}
+
+// SaveLog writes the redaction log to the configured log file, readable only by the current user.
+// The log is never passed to writers or sinks, it stays on this machine.
+func (r *Redactor) SaveLog() error {
+	if r.logFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.Log(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(r.logFile, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Chmod(r.logFile, 0600) // WriteFile keeps the mode of an existing file
+}
+
+func (*Redactor) Name() string { return TypeRedact }
+
+var _ keep.Transformer = (*Redactor)(nil)
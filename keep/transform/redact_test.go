@@ -0,0 +1,146 @@
+package transform
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+)
+
+func redactText(t *testing.T, opts RedactOptions, s string) string {
+	t.Helper()
+	r, err := NewRedactor(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &loader.Note{TextContent: s}
+	if err := r.Transform(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	return n.TextContent
+}
+
+func TestRedactBuiltIns(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		// cards must pass the Luhn check
+		{"card 4111 1111 1111 1111 exp 12/27", "card [REDACTED:CARD] exp 12/27"},
+		{"card 4111-1111-1111-1111", "card [REDACTED:CARD]"},
+		{"amex 378282246310005", "amex [REDACTED:CARD]"},
+		{"ref 4111111111111112", "ref 4111111111111112"},
+		{"ref 1234567890123", "ref 1234567890123"},
+
+		// only the value after the keyword is redacted
+		{"pwd: x", "pwd: [REDACTED:PASSWORD]"},
+		{"wifi password is hunter2", "wifi password is [REDACTED:PASSWORD]"},
+		{"PIN=1234", "PIN=[REDACTED:PASSWORD]"},
+		{"pinned to the fridge", "pinned to the fridge"},
+
+		{"mail bob.smith+keep@example.co.uk today", "mail [REDACTED:EMAIL] today"},
+		{"call +1 (555) 123-4567 or 555.123.4567", "call [REDACTED:PHONE] or [REDACTED:PHONE]"},
+		{"+44 20 7946 0958", "[REDACTED:PHONE]"},
+
+		// numbers that aren't phone numbers
+		{"buy 3 eggs and 12 rolls", "buy 3 eggs and 12 rolls"},
+		{"meet at 10:30 on 2021-06-17", "meet at 10:30 on 2021-06-17"},
+		{"rent £1,250.00 due 17/06/2021", "rent £1,250.00 due 17/06/2021"},
+		{"order #12345, room 1204", "order #12345, room 1204"},
+		{"version 1.2.3 on 192.168.1.1", "version 1.2.3 on 192.168.1.1"},
+		{"since 1999", "since 1999"},
+	} {
+		if got := redactText(t, RedactOptions{}, tc.in); got != tc.want {
+			t.Errorf("redact(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRedactTypes(t *testing.T) {
+	in := "bob@example.com 555-123-4567"
+	if got, want := redactText(t, RedactOptions{Types: []string{RedactEmail}}, in), "[REDACTED:EMAIL] 555-123-4567"; got != want {
+		t.Errorf("redact(%q) = %q, want %q", in, got, want)
+	}
+	if _, err := NewRedactor(RedactOptions{Types: []string{"ssn"}}); err == nil {
+		t.Errorf("NewRedactor() with an unknown type succeeded, want an error")
+	}
+}
+
+func TestRedactPatternsAndWords(t *testing.T) {
+	opts := RedactOptions{
+		Types:    []string{RedactPhone},
+		Patterns: []RedactPattern{{Name: "ssn", Pattern: `\b\d{3}-\d{2}-\d{4}\b`}},
+		Words:    []string{"Project X", "cat"},
+	}
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"ssn 123-45-6789", "ssn [REDACTED:SSN]"}, // patterns run before the phone detector
+		{"project x launch", "[REDACTED:WORD] launch"},
+		{"the cat, not concatenate", "the [REDACTED:WORD], not concatenate"},
+	} {
+		if got := redactText(t, opts, tc.in); got != tc.want {
+			t.Errorf("redact(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+	if _, err := NewRedactor(RedactOptions{Patterns: []RedactPattern{{Name: "bad", Pattern: "("}}}); err == nil {
+		t.Errorf("NewRedactor() with an invalid pattern succeeded, want an error")
+	}
+}
+
+func TestLuhn(t *testing.T) {
+	for s, want := range map[string]bool{
+		"4111111111111111":    true,
+		"4111 1111 1111 1111": true,
+		"5555555555554444":    true,
+		"4111111111111112":    false,
+		"79927398713":         false, // valid checksum but too short for a card
+		"0000000000000":       true,
+	} {
+		if got := luhn(s); got != want {
+			t.Errorf("luhn(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestRedactTransform(t *testing.T) {
+	created := loader.MicroTime(time.Date(2020, time.October, 19, 0, 0, 0, 0, time.UTC))
+	n := &loader.Note{
+		FileName:       "mail bob@example.com",
+		Title:          "mail bob@example.com",
+		ExtractedTitle: "mail bob@example.com",
+		TextContent:    "pwd: x",
+		ListContent:    []loader.ListItem{{Text: "milk"}, {Text: "call 555-123-4567"}},
+		CreatedMicros:  &created,
+	}
+	n.FixID()
+	id := n.ID()
+	r, err := NewRedactor(RedactOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Transform(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n.FileName != "mail [REDACTED:EMAIL]" || n.Title != n.FileName || n.ExtractedTitle != n.FileName {
+		t.Errorf("got file name %q, title %q and extracted title %q, want the email redacted from each", n.FileName, n.Title, n.ExtractedTitle)
+	}
+	if n.ListContent[0].Text != "milk" || n.ListContent[1].Text != "call [REDACTED:PHONE]" {
+		t.Errorf("got list %+v, want only the phone number redacted", n.ListContent)
+	}
+	if n.ID() != id {
+		t.Errorf("got id %s after redaction, want %s from before", n.ID(), id)
+	}
+
+	want := []Redaction{
+		{NoteID: id, FileName: "mail bob@example.com", Field: "title", Type: RedactEmail, Value: "bob@example.com"},
+		{NoteID: id, FileName: "mail bob@example.com", Field: "text", Type: RedactPassword, Value: "x"},
+		{NoteID: id, FileName: "mail bob@example.com", Field: "list[1]", Type: RedactPhone, Value: "555-123-4567"},
+		{NoteID: id, FileName: "mail bob@example.com", Field: "file_name", Type: RedactEmail, Value: "bob@example.com"},
+	}
+	if got := r.Log(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got log %+v, want %+v", got, want)
+	}
+}
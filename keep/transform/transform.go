@@ -0,0 +1,212 @@
+// Package transform has the built in note transformers, they clean up notes before they are written.
+package transform
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"encoding/json"
+	"unicode/utf8"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep"
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+)
+
+// Names of the built in transformers.
+const (
+	TypeTrim               = "trim"
+	TypeNormalizeNewlines  = "normalize_newlines"
+	TypeCollapseBlankLines = "collapse_blank_lines"
+	TypeTitleFromFirstLine = "title_from_first_line"
+	TypeLabelRules         = "label_rules"
+)
+
+// eachText calls fun on every piece of text in the note: title, body and list items.
+func eachText(n *loader.Note, fun func(string) string) {
+	n.Title = fun(n.Title)
+	n.TextContent = fun(n.TextContent)
+	for i := range n.ListContent {
+		n.ListContent[i].Text = fun(n.ListContent[i].Text)
+	}
+}
+
+// Trim removes leading and trailing whitespace from the title, body and list items, and trailing whitespace from each line.
+type Trim struct{}
+
+func (Trim) Transform(_ context.Context, n *loader.Note) error {
+	eachText(n, func(s string) string {
+		lines := strings.Split(s, "\n")
+		for i, l := range lines {
+			lines[i] = strings.TrimRight(l, " \t\r")
+		}
+		return strings.TrimSpace(strings.Join(lines, "\n"))
+	})
+	return nil
+}
+
+func (Trim) Name() string { return TypeTrim }
+
+// NormalizeNewlines turns \r\n and lone \r into \n.
+type NormalizeNewlines struct{}
+
+var newlines = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+func (NormalizeNewlines) Transform(_ context.Context, n *loader.Note) error {
+	eachText(n, newlines.Replace)
+	return nil
+}
+
+func (NormalizeNewlines) Name() string { return TypeNormalizeNewlines }
+
+// CollapseBlankLines limits runs of blank lines in the body to Max, 0 is treated as 1.
+type CollapseBlankLines struct {
+	Max int
+}
+
+var blankLines = regexp.MustCompile(`\n([ \t]*\n)+`)
+
+func (c CollapseBlankLines) Transform(_ context.Context, n *loader.Note) error {
+	max := c.Max
+	if max < 1 {
+		max = 1
+	}
+	n.TextContent = blankLines.ReplaceAllStringFunc(n.TextContent, func(run string) string {
+		if strings.Count(run, "\n")-1 <= max {
+			return run
+		}
+		return strings.Repeat("\n", max+1)
+	})
+	return nil
+}
+
+func (CollapseBlankLines) Name() string { return TypeCollapseBlankLines }
+
+// TitleFromFirstLine titles notes that had no title in Keep with the first line of the body or first list item.
+// Titles are cut to MaxLength runes, 0 is treated as 60.
+type TitleFromFirstLine struct {
+	MaxLength int
+}
+
+func (t TitleFromFirstLine) Transform(_ context.Context, n *loader.Note) error {
+	if n.ExtractedTitle != "" {
+		return nil
+	}
+	text := n.TextContent
+	if text == "" && len(n.ListContent) > 0 {
+		text = n.ListContent[0].Text
+	}
+	var title string
+	for _, line := range strings.Split(text, "\n") {
+		if title = strings.TrimSpace(line); title != "" {
+			break
+		}
+	}
+	if title == "" {
+		return nil // keep the file name
+	}
+	max := t.MaxLength
+	if max < 1 {
+		max = 60
+	}
+	if utf8.RuneCountInString(title) > max {
+		title = strings.TrimSpace(string([]rune(title)[:max]))
+	}
+	n.Title = title
+	n.ExtractedTitle = title
+	return nil
+}
+
+func (TitleFromFirstLine) Name() string { return TypeTitleFromFirstLine }
+
+// LabelRule adds Label to notes whose title, body or list items match Pattern.
+type LabelRule struct {
+	Pattern string `json:"pattern"` // Go regexp, use (?i) to ignore case
+	Label   string `json:"label"`
+}
+
+// LabelRules adds labels to notes matching regex rules, labels already on the note aren't duplicated.
+type LabelRules struct {
+	rules []LabelRule
+	res   []*regexp.Regexp
+}
+
+// NewLabelRules compiles the rules.
+func NewLabelRules(rules []LabelRule) (*LabelRules, error) {
+	l := &LabelRules{rules: rules}
+	for _, r := range rules {
+		if r.Label == "" {
+			return nil, fmt.Errorf("label rule %q has no label", r.Pattern)
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling label rule %q: %v", r.Pattern, err)
+		}
+		l.res = append(l.res, re)
+	}
+	return l, nil
+}
+
+func (l *LabelRules) Transform(_ context.Context, n *loader.Note) error {
+	for i, re := range l.res {
+		if n.HasLabel(l.rules[i].Label) || !matches(re, n) {
+			continue
+		}
+		n.Labels = append(n.Labels, loader.ListLabel{Name: l.rules[i].Label})
+	}
+	return nil
+}
+
+func matches(re *regexp.Regexp, n *loader.Note) bool {
+	if re.MatchString(n.Title) || re.MatchString(n.TextContent) {
+		return true
+	}
+	for _, item := range n.ListContent {
+		if re.MatchString(item.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (*LabelRules) Name() string { return TypeLabelRules }
+
+// New builds a built in transformer by type, max is the blank lines kept or the title length and rules are for label_rules.
+func New(typ string, max int, rules []LabelRule) (keep.Transformer, error) {
+	switch typ {
+	case TypeTrim:
+		return Trim{}, nil
+	case TypeNormalizeNewlines:
+		return NormalizeNewlines{}, nil
+	case TypeCollapseBlankLines:
+		return CollapseBlankLines{Max: max}, nil
+	case TypeTitleFromFirstLine:
+		return TitleFromFirstLine{MaxLength: max}, nil
+	case TypeLabelRules:
+		return NewLabelRules(rules)
+	}
+	return nil, fmt.Errorf("unknown transform %q", typ)
+}
+
+// LoadLabelRules reads a JSON list of label rules.
+func LoadLabelRules(path string) ([]LabelRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []LabelRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("error parsing label rules %s: %v", path, err)
+	}
+	return rules, nil
+}
+
+var (
+	_ keep.Transformer = Trim{}
+	_ keep.Transformer = NormalizeNewlines{}
+	_ keep.Transformer = CollapseBlankLines{}
+	_ keep.Transformer = TitleFromFirstLine{}
+	_ keep.Transformer = (*LabelRules)(nil)
+)
@@ -0,0 +1,13 @@
+package keep
+
+import (
+	"context"
+
+	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
+)
+
+// Transformer rewrites notes in place after filtering, before any writer sees them.
+// Transform is called one note at a time, in the order transformers are listed.
+type Transformer interface {
+	Transform(ctx context.Context, n *loader.Note) error
+}
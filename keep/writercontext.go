@@ -1,10 +1,19 @@
 package keep
 
 import (
+	"context"
+
 	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
 )
 
+// NoteWriter receives every exported note, WriteNote may be called concurrently.
+// Flush is called once after every note has been written.
 type NoteWriter interface {
-	WriteNote(n *loader.Note) error
-	Flush() error
+	WriteNote(ctx context.Context, n *loader.Note) error
+	Flush(ctx context.Context) error
+}
+
+// Named is optionally implemented by writers to identify them in reports.
+type Named interface {
+	Name() string
 }
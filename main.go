@@ -1,31 +1,68 @@
 // Converts https://takeout.google.com google keep and exports to hopefully useful formats
-// This is all in 1 file to make this more copy paste forkable.
+// This is a thin flag wrapper around keep/export, which can be used directly from other Go code.
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"os"
+	"runtime"
 	"strings"
 	"time"
 
 	"github.com/golang/glog"
-	"golang.org/x/sync/errgroup"
 
 	"github.com/dragon1672/go-keep-export-to-text/keep"
+	"github.com/dragon1672/go-keep-export-to-text/keep/config"
+	"github.com/dragon1672/go-keep-export-to-text/keep/dedup"
+	"github.com/dragon1672/go-keep-export-to-text/keep/export"
 	"github.com/dragon1672/go-keep-export-to-text/keep/loader"
-	"github.com/dragon1672/go-keep-export-to-text/keep/output/console"
-	"github.com/dragon1672/go-keep-export-to-text/keep/output/md"
-	"github.com/dragon1672/go-keep-export-to-text/keep/output/opml"
+	"github.com/dragon1672/go-keep-export-to-text/keep/output/gitrepo"
 	"github.com/dragon1672/go-keep-export-to-text/keep/output/pdf"
-	"github.com/dragon1672/go-keep-export-to-text/keep/output/text"
+	"github.com/dragon1672/go-keep-export-to-text/keep/transform"
+)
+
+// Config files
+var (
+	ConfigFile = flag.String("config", "", "optional JSON config file describing the source, filters and writers. Explicitly set flags override config values")
+	Profile    = flag.String("profile", "", "optional named profile from --config to layer over the base config, eg: obsidian")
 )
 
 // Inputs
 var (
 	ZipFilePath   = flag.String("zip_file_path", "example-takeout.zip", "zip file path to be unpacked and parsed")
 	SubFolderPath = flag.String("sub_folder_path", "Takeout/Keep/", "required sub folder")
-	
-	DateMin	   = flag.String("date_min", "2024-09-30", "optional min date filter (inclusive) format YYYY-MM-DD")
-	DateMax	   = flag.String("date_max", "", "optional max date filter (inclusive) format YYYY-MM-DD")
+	Lenient       = flag.Bool("lenient", false, "Skip notes that fail to parse instead of stopping, they are listed in the run report")
+	QuarantineDir = flag.String("quarantine_dir", "", "With --lenient, optionally copy notes that fail to parse into this dir")
+	Merge         = flag.String("merge", "", "optional comma separated takeouts to merge instead of --zip_file_path, each as path or account=path, notes in more than one keep their latest edit")
+	TagAccount    = flag.Bool("tag_account", false, "With --merge, label each note with the account it came from, defaulting to the zip file name")
+
+	MaxEntries          = flag.Int("max_entries", loader.DefaultLimits.MaxEntries, "Max number of entries in the zip (including attachments), 0 for unlimited")
+	MaxEntrySize        = flag.Int64("max_entry_size", loader.DefaultLimits.MaxEntrySize, "Max uncompressed bytes per note, 0 for unlimited")
+	MaxTotalSize        = flag.Int64("max_total_size", loader.DefaultLimits.MaxTotalSize, "Max uncompressed bytes read across all notes, 0 for unlimited")
+	MaxCompressionRatio = flag.Float64("max_compression_ratio", loader.DefaultLimits.MaxCompressionRatio, "Max uncompressed/compressed size of a note over 1 MiB, 0 for unlimited")
+
+	ParseWorkers = flag.Int("parse_workers", runtime.NumCPU(), "Number of notes parsed in parallel, 1 parses serially")
+	Ordered      = flag.Bool("ordered", false, "Deliver notes in zip order when parsing in parallel")
+
+	DateMin = flag.String("date_min", "", "optional min date filter (inclusive) format YYYY-MM-DD")
+	DateMax = flag.String("date_max", "", "optional max date filter (inclusive) format YYYY-MM-DD")
+
+	EditedMin       = flag.String("edited_min", "", "optional min last edited date filter (inclusive) format YYYY-MM-DD")
+	EditedMax       = flag.String("edited_max", "", "optional max last edited date filter (inclusive) format YYYY-MM-DD")
+	Since           = flag.String("since", "", "only notes created since a date (YYYY-MM-DD) or a relative amount, eg: 36h, 90d, 12w, 6m or 1y")
+	EditedSince     = flag.String("edited_since", "", "only notes edited since a date, a relative amount like --since, or 'last-export' for the time the previous export started")
+	IncludeArchived = flag.Bool("include_archived", false, "Export archived notes, see --state_routing")
+	IncludeTrashed  = flag.Bool("include_trashed", false, "Export trashed notes, see --state_routing")
+	IncludeLabels   = flag.String("include_labels", "", "optional comma separated labels, only notes with at least one of them are exported")
+	ExcludeLabels   = flag.String("exclude_labels", "", "optional comma separated labels, notes with any of them are skipped")
+	UnlabeledOnly   = flag.Bool("unlabeled_only", false, "only export notes without labels, --default_tags don't count")
+	LabelMap        = flag.String("label_map", "", "optional JSON file to rename, merge, split or drop labels before filtering, see the README")
+	Dedup           = flag.String("dedup", "off", "find duplicate notes: off, report (list them), skip (only export the newest of each) or merge-labels (skip, giving the newest every label)")
+	DedupThreshold  = flag.Float64("dedup_threshold", 0.9, "similarity (0-1) of title, body and list words for near duplicates, 1 only finds exact duplicates")
+	LastExportFile  = flag.String("last_export_file", ".keep-last-export", "where --edited_since=last-export reads and saves the time of the last export")
 )
 
 // Outputs
@@ -35,116 +72,456 @@ var (
 	MdOutputDir    = flag.String("md_output_dir", "md_out", "markdown output file dir. Optionally create directories controlled by --create_out")
 	OutputOPMLFile = flag.String("output_ompl_file", "out.opml", "output OPML file. Optionally create directories controlled by --create_out")
 
+	OutputArchive = flag.String("output_archive", "", "optional .zip, .tar.gz or .tgz to write every writer's files into instead of the filesystem, eg: export.zip")
+
+	AgeRecipients     = flag.String("age_recipients", "", "optional comma separated age public keys (age1...) to encrypt every output file, or the whole --output_archive, to. Files get a .age extension")
+	AgeRecipientsFile = flag.String("age_recipients_file", "", "optional file of age public keys to encrypt to, one per line")
+	AgePassphraseEnv  = flag.String("age_passphrase_env", "", "optional environment variable holding a passphrase to encrypt the --output_archive (or decrypt) with instead of public keys")
+	AgeIdentityFile   = flag.String("age_identity_file", "", "age identity file (from age-keygen) the decrypt command uses")
+
 	OutputPDFDir = flag.String("output_pdf_dir", ".", "output PDF file. This will compact multiple notes into a PDF")
-	PDFWordLimit = flag.Int("pdf_word_limit", 500000, "Limit the number of words in the PDF output. This is default set to notebooklm limit of 500,000 words")
+	GitRepoDir   = flag.String("git_repo_dir", "", "optional git repo to commit notes to, one commit per changed note dated from its edit time, created if missing")
+	GitFormat    = flag.String("git_format", "markdown", "Format of the files committed to --git_repo_dir, markdown or text")
+	GitAuthor    = flag.String("git_author", gitrepo.DefaultAuthor, "Name and email every --git_repo_dir commit is signed with")
+	PDFWordLimit = flag.Int("pdf_word_limit", pdf.DefaultWordLimit, "Limit the number of words in the PDF output. This is default set to notebooklm limit of 500,000 words")
 )
 
 // Configurations
 var (
-	FileNameStrat      = flag.String("output_file_name_strat", keep.StratDateAndTitle, "How to resolve file names")
+	FileNameStrat      = flag.String("output_file_name_strat", keep.StratDateAndTitle, "How to resolve file names: direct_export, favor_date, date_and_title or note_id (which keeps titles out of file names)")
 	CreateYearFolders  = flag.Bool("output_create_year_folders", true, "Create sub folders for each year")
 	CreateMonthFolders = flag.Bool("output_create_month_folders", true, "Create sub folders for each month (requires --output_create_year_folders, otherwise is ignored) This will include both the month number (0 padded), and the month name")
 	CreateOut          = flag.Bool("create_out", true, "Attempt to create output dir")
+	KeepGoing          = flag.Bool("keep_going", false, "Record failed note writes in the report and carry on instead of stopping at the first one, the exit code is still non-zero")
+	ReportFormat       = flag.String("report_format", "table", "Format of the run report printed to stderr: table, json or none")
+	Parallelism        = flag.Int("parallelism", runtime.NumCPU(), "Max number of note writes in flight, reading the zip pauses while all workers are busy")
+	PreserveModTime    = flag.Bool("preserve_mod_time", false, "Set each output file's modified time to the note's last edit (falling back to creation) time, combined files like OPML and PDF use the newest note")
+	Overwrite          = flag.String("overwrite", keep.OverwriteAlways, "What to do when an output file already exists: overwrite, skip-existing, fail, backup (keep the old file as .bak) or suffix (write `name (N).ext`)")
+	DryRun             = flag.Bool("dry_run", false, "Print the export plan (files per writer, PDF chunks, collisions and skipped notes) without touching the filesystem")
+	Timezone           = flag.String("timezone", "", "IANA time zone dates are rendered and filtered in, eg: America/Los_Angeles, defaults to the local zone")
+	DateLayout         = flag.String("date_layout", "2006-01-02", "Go time layout for dates rendered in notes, eg: '2006-01-02 15:04 MST', or rfc3339 for full timestamps")
+	StateRouting       = flag.String("state_routing", keep.RouteSplit, "How writers output archived and trashed notes: split (archive/ and trash/ subfolders, separate OPML branches and PDFs), tag (add an archived or trashed label) or none")
+	FileDateLayout     = flag.String("file_date_layout", "2006-01-02", "Go time layout for dates in file names, or rfc3339, avoid ':' on Windows")
+	DryRunFormat       = flag.String("dry_run_format", "text", "Format of the --dry_run plan, text or json")
+	StatsFormat        = flag.String("stats_format", "table", "Format of the stats command, table, json or html (a standalone page with a calendar heatmap)")
+	DiffFormat         = flag.String("diff_format", "text", "Format of the diff command, text (unified diffs) or json")
+	Incremental        = flag.Bool("incremental", false, "Only write files that changed since the previous run, tracked by a manifest stored in each writer's output dir")
+	IncrementalRemoved = flag.String("incremental_removed", keep.RemovedKeep, "With --incremental, what to do with outputs of notes missing from this run: keep, delete or quarantine")
+	Transforms         = flag.String("transforms", "", "optional comma separated transforms applied in order to every exported note: trim, normalize_newlines, collapse_blank_lines, title_from_first_line")
+	LabelRules         = flag.String("label_rules", "", "optional JSON file of regex rules adding labels to matching notes, applied after --transforms, eg: [{\"pattern\": \"(?i)recipe\", \"label\": \"recipes\"}]")
+	Redact             = flag.Bool("redact", false, "Replace emails, phone numbers, card numbers and passwords in notes with placeholders like [REDACTED:EMAIL], after every other transform")
+	RedactTypes        = flag.String("redact_types", "", "With --redact, comma separated detectors to use instead of all of them: password, email, card, phone")
+	RedactPatterns     = flag.String("redact_patterns", "", "With --redact, optional JSON file of extra regexes to redact, eg: [{\"name\": \"ssn\", \"pattern\": \"\\\\d{3}-\\\\d{2}-\\\\d{4}\"}]")
+	RedactWords        = flag.String("redact_words", "", "With --redact, optional file of words or phrases to redact, one per line")
+	RedactionLog       = flag.String("redaction_log", "", "With --redact, optionally log every redacted value to this local file, it contains the original text so keep it private")
 	DefaultTags        = flag.String("default_tags", "google_keep_export", "comma seperated list of default tags to apply to all tags")
 )
 
-func loadWriters() []keep.NoteWriter {
-	writer := &keep.FileWriter{
-		CreateDir: *CreateOut,
-		Stdout:    *StdOut,
+// flagConfig builds the config described by flag values alone, this is the base any --config file is layered over.
+func flagConfig() *config.Config {
+	c := &config.Config{
+		Source: config.Source{
+			ZipFilePath:   *ZipFilePath,
+			SubFolderPath: *SubFolderPath,
+			DefaultTags:   splitList(*DefaultTags),
+			Lenient:       *Lenient,
+			QuarantineDir: *QuarantineDir,
+
+			MaxEntries:          *MaxEntries,
+			MaxEntrySize:        *MaxEntrySize,
+			MaxTotalSize:        *MaxTotalSize,
+			MaxCompressionRatio: *MaxCompressionRatio,
+
+			ParseWorkers: *ParseWorkers,
+			Ordered:      *Ordered,
+			LabelMapFile: *LabelMap,
+
+			Dedup:          *Dedup,
+			DedupThreshold: *DedupThreshold,
+
+			Merge:      mergeSources(*Merge),
+			TagAccount: *TagAccount,
+		},
+		Filters: config.Filters{
+			DateMin: *DateMin,
+			DateMax: *DateMax,
+
+			EditedMin:      *EditedMin,
+			EditedMax:      *EditedMax,
+			Since:          *Since,
+			EditedSince:    *EditedSince,
+			LastExportFile: *LastExportFile,
+			IncludeLabels:  splitList(*IncludeLabels),
+			ExcludeLabels:  splitList(*ExcludeLabels),
+			UnlabeledOnly:  *UnlabeledOnly,
+
+			IncludeArchived: *IncludeArchived,
+			IncludeTrashed:  *IncludeTrashed,
+		},
+		Output: config.Output{
+			FileNameStrat:      *FileNameStrat,
+			CreateYearFolders:  *CreateYearFolders,
+			CreateMonthFolders: *CreateMonthFolders,
+			CreateOut:          *CreateOut,
+			Overwrite:          *Overwrite,
+			Archive:            *OutputArchive,
+			PreserveModTime:    *PreserveModTime,
+			Timezone:           *Timezone,
+			DateLayout:         *DateLayout,
+			FileDateLayout:     *FileDateLayout,
+			StateRouting:       *StateRouting,
+			Incremental:        *Incremental,
+			IncrementalRemoved: *IncrementalRemoved,
+			Parallelism:        *Parallelism,
+			KeepGoing:          *KeepGoing,
+			ReportFormat:       *ReportFormat,
+			Encryption: config.Encryption{
+				Recipients:     splitList(*AgeRecipients),
+				RecipientsFile: *AgeRecipientsFile,
+				PassphraseEnv:  *AgePassphraseEnv,
+			},
+		},
 	}
-	fileGenerator := &keep.FileNameGenerator{
-		GenerateYearFolders:  *CreateYearFolders,
-		GenerateMonthFolders: *CreateMonthFolders,
-		NameStrat:            *FileNameStrat,
+	for _, name := range []string{"std_out", "output_ompl_file", "txt_output_dir", "md_output_dir", "output_pdf_dir", "git_repo_dir"} {
+		writerFlagOverrides[name](c)
 	}
+	c.Transforms = flagTransforms()
+	return c
+}
 
-	var ws []keep.NoteWriter
-	if *StdOut {
-		ws = append(ws, &console.StdOut{})
+// flagTransforms are the transforms set by --transforms, --label_rules and --redact.
+func flagTransforms() []config.Transform {
+	var ts []config.Transform
+	for _, t := range splitList(*Transforms) {
+		ts = append(ts, config.Transform{Type: t})
 	}
-	if *OutputOPMLFile != "" {
-		ws = append(ws, &opml.Builder{Writer: writer, OutputFile: *OutputOPMLFile})
+	if *LabelRules != "" {
+		ts = append(ts, config.Transform{Type: transform.TypeLabelRules, RulesFile: *LabelRules})
 	}
-	if *TxtOutputDir != "" {
-		ws = append(ws, &text.Writer{Writer: writer, Generator: fileGenerator, OutDir: *TxtOutputDir})
+	if *Redact {
+		ts = append(ts, config.Transform{Type: transform.TypeRedact, Redact: &transform.RedactOptions{
+			Types:        splitList(*RedactTypes),
+			PatternsFile: *RedactPatterns,
+			WordsFile:    *RedactWords,
+			LogFile:      *RedactionLog,
+		}})
 	}
-	if *MdOutputDir != "" {
-		ws = append(ws, &md.Writer{Writer: writer, Generator: fileGenerator, OutDir: *MdOutputDir})
-	}
-	if *OutputPDFDir != "" {
-		ws = append(ws, &pdf.Builder{Writer: writer, OutputDir: *OutputPDFDir, WordLimit: *PDFWordLimit})
+	return ts
+}
+
+// writerFlagOverrides map flags to the writers they control. Set to empty to remove the writer.
+var writerFlagOverrides = map[string]func(c *config.Config){
+	"std_out": func(c *config.Config) {
+		if *StdOut {
+			c.SetWriter(config.WriterConsole, &config.Writer{})
+		} else {
+			c.SetWriter(config.WriterConsole, nil)
+		}
+	},
+	"output_ompl_file": func(c *config.Config) {
+		if *OutputOPMLFile != "" {
+			c.SetWriter(config.WriterOPML, &config.Writer{OutputFile: *OutputOPMLFile})
+		} else {
+			c.SetWriter(config.WriterOPML, nil)
+		}
+	},
+	"txt_output_dir": func(c *config.Config) {
+		if *TxtOutputDir != "" {
+			c.SetWriter(config.WriterText, &config.Writer{OutDir: *TxtOutputDir})
+		} else {
+			c.SetWriter(config.WriterText, nil)
+		}
+	},
+	"md_output_dir": func(c *config.Config) {
+		if *MdOutputDir != "" {
+			c.SetWriter(config.WriterMarkdown, &config.Writer{OutDir: *MdOutputDir})
+		} else {
+			c.SetWriter(config.WriterMarkdown, nil)
+		}
+	},
+	"output_pdf_dir": func(c *config.Config) {
+		if *OutputPDFDir != "" {
+			c.SetWriter(config.WriterPDF, &config.Writer{OutDir: *OutputPDFDir, WordLimit: *PDFWordLimit})
+		} else {
+			c.SetWriter(config.WriterPDF, nil)
+		}
+	},
+	"git_repo_dir": func(c *config.Config) {
+		if *GitRepoDir != "" {
+			c.SetWriter(config.WriterGit, &config.Writer{OutDir: *GitRepoDir, Format: *GitFormat, Author: *GitAuthor})
+		} else {
+			c.SetWriter(config.WriterGit, nil)
+		}
+	},
+	"pdf_word_limit": func(c *config.Config) {
+		for i := range c.Writers {
+			if c.Writers[i].Type == config.WriterPDF {
+				c.Writers[i].WordLimit = *PDFWordLimit
+			}
+		}
+	},
+}
+
+// flagOverrides map flags to the config fields they replace when explicitly set alongside --config.
+var flagOverrides = map[string]func(c *config.Config){
+	"zip_file_path":   func(c *config.Config) { c.Source.ZipFilePath = *ZipFilePath },
+	"sub_folder_path": func(c *config.Config) { c.Source.SubFolderPath = *SubFolderPath },
+	"default_tags":    func(c *config.Config) { c.Source.DefaultTags = splitList(*DefaultTags) },
+	"lenient":         func(c *config.Config) { c.Source.Lenient = *Lenient },
+	"quarantine_dir":  func(c *config.Config) { c.Source.QuarantineDir = *QuarantineDir },
+
+	"max_entries":           func(c *config.Config) { c.Source.MaxEntries = *MaxEntries },
+	"max_entry_size":        func(c *config.Config) { c.Source.MaxEntrySize = *MaxEntrySize },
+	"max_total_size":        func(c *config.Config) { c.Source.MaxTotalSize = *MaxTotalSize },
+	"max_compression_ratio": func(c *config.Config) { c.Source.MaxCompressionRatio = *MaxCompressionRatio },
+	"parse_workers":         func(c *config.Config) { c.Source.ParseWorkers = *ParseWorkers },
+	"ordered":               func(c *config.Config) { c.Source.Ordered = *Ordered },
+	"date_min":              func(c *config.Config) { c.Filters.DateMin = *DateMin },
+	"date_max":              func(c *config.Config) { c.Filters.DateMax = *DateMax },
+	"edited_min":            func(c *config.Config) { c.Filters.EditedMin = *EditedMin },
+	"edited_max":            func(c *config.Config) { c.Filters.EditedMax = *EditedMax },
+	"since":                 func(c *config.Config) { c.Filters.Since = *Since },
+	"edited_since":          func(c *config.Config) { c.Filters.EditedSince = *EditedSince },
+	"last_export_file":      func(c *config.Config) { c.Filters.LastExportFile = *LastExportFile },
+	"include_labels":        func(c *config.Config) { c.Filters.IncludeLabels = splitList(*IncludeLabels) },
+	"exclude_labels":        func(c *config.Config) { c.Filters.ExcludeLabels = splitList(*ExcludeLabels) },
+	"unlabeled_only":        func(c *config.Config) { c.Filters.UnlabeledOnly = *UnlabeledOnly },
+	"include_archived":      func(c *config.Config) { c.Filters.IncludeArchived = *IncludeArchived },
+	"include_trashed":       func(c *config.Config) { c.Filters.IncludeTrashed = *IncludeTrashed },
+	"label_map":             func(c *config.Config) { c.Source.LabelMapFile = *LabelMap },
+	"dedup":                 func(c *config.Config) { c.Source.Dedup = *Dedup },
+	"merge":                 func(c *config.Config) { c.Source.Merge = mergeSources(*Merge) },
+	"tag_account":           func(c *config.Config) { c.Source.TagAccount = *TagAccount },
+	"dedup_threshold":       func(c *config.Config) { c.Source.DedupThreshold = *DedupThreshold },
+	"transforms":            func(c *config.Config) { c.Transforms = flagTransforms() },
+	"label_rules":           func(c *config.Config) { c.Transforms = flagTransforms() },
+	"redact":                func(c *config.Config) { c.Transforms = flagTransforms() },
+	"redact_types":          func(c *config.Config) { c.Transforms = flagTransforms() },
+	"redact_patterns":       func(c *config.Config) { c.Transforms = flagTransforms() },
+	"redact_words":          func(c *config.Config) { c.Transforms = flagTransforms() },
+	"redaction_log":         func(c *config.Config) { c.Transforms = flagTransforms() },
+
+	"output_file_name_strat":      func(c *config.Config) { c.Output.FileNameStrat = *FileNameStrat },
+	"output_create_year_folders":  func(c *config.Config) { c.Output.CreateYearFolders = *CreateYearFolders },
+	"output_create_month_folders": func(c *config.Config) { c.Output.CreateMonthFolders = *CreateMonthFolders },
+	"create_out":                  func(c *config.Config) { c.Output.CreateOut = *CreateOut },
+	"overwrite":                   func(c *config.Config) { c.Output.Overwrite = *Overwrite },
+	"output_archive":              func(c *config.Config) { c.Output.Archive = *OutputArchive },
+	"preserve_mod_time":           func(c *config.Config) { c.Output.PreserveModTime = *PreserveModTime },
+	"timezone":                    func(c *config.Config) { c.Output.Timezone = *Timezone },
+	"date_layout":                 func(c *config.Config) { c.Output.DateLayout = *DateLayout },
+	"file_date_layout":            func(c *config.Config) { c.Output.FileDateLayout = *FileDateLayout },
+	"state_routing":               func(c *config.Config) { c.Output.StateRouting = *StateRouting },
+	"age_recipients":              func(c *config.Config) { c.Output.Encryption.Recipients = splitList(*AgeRecipients) },
+	"age_recipients_file":         func(c *config.Config) { c.Output.Encryption.RecipientsFile = *AgeRecipientsFile },
+	"age_passphrase_env":          func(c *config.Config) { c.Output.Encryption.PassphraseEnv = *AgePassphraseEnv },
+	"incremental":                 func(c *config.Config) { c.Output.Incremental = *Incremental },
+	"incremental_removed":         func(c *config.Config) { c.Output.IncrementalRemoved = *IncrementalRemoved },
+	"parallelism":                 func(c *config.Config) { c.Output.Parallelism = *Parallelism },
+	"keep_going":                  func(c *config.Config) { c.Output.KeepGoing = *KeepGoing },
+	"report_format":               func(c *config.Config) { c.Output.ReportFormat = *ReportFormat },
+}
+
+// splitList splits a comma separated flag, an empty flag is an empty list.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
 	}
-	return ws
+	return list
 }
 
-func dateParser(s string) (time.Time, bool, error) {
-	if s == "" {
-		var t time.Time
-		return t, false, nil
+func loadConfig() (*config.Config, error) {
+	c := flagConfig()
+	if *ConfigFile == "" {
+		if *Profile != "" {
+			return nil, fmt.Errorf("--profile=%s requires --config", *Profile)
+		}
+		return c, c.Validate()
 	}
-	t, err := time.Parse("2006-01-02", s)
+	// only writers from the config, or writer flags explicitly set, are used, not the flag defaults
+	c.Writers = nil
+	c, err := config.Load(*ConfigFile, *Profile, c)
 	if err != nil {
-		var t time.Time
-		return t, false, err
+		return nil, err
 	}
-	return t, true, nil
+	flag.Visit(func(f *flag.Flag) {
+		if override, ok := flagOverrides[f.Name]; ok {
+			override(c)
+		}
+		if override, ok := writerFlagOverrides[f.Name]; ok {
+			override(c)
+		}
+	})
+	return c, c.Validate()
 }
 
-func main() {
-	flag.Parse()
+// startTime is when the run started, relative dates count back from here and it's saved as the last export time.
+var startTime = time.Now()
 
-	filters := loader.Filters {
-		func(n*loader.Note) bool { return !n.IsTrashed},
-		func(n*loader.Note) bool { return !n.IsArchived},
+// mergeSources parses --merge, a comma separated list of path or account=path.
+func mergeSources(s string) []config.MergeSource {
+	var sources []config.MergeSource
+	for _, item := range splitList(s) {
+		m := config.MergeSource{Path: item}
+		if account, path, ok := strings.Cut(item, "="); ok {
+			m = config.MergeSource{Path: strings.TrimSpace(path), Account: strings.TrimSpace(account)}
+		}
+		sources = append(sources, m)
 	}
+	return sources
+}
 
-	if dateMin, ok, err := dateParser(*DateMin); err != nil {
-		glog.Fatalf("error parsing date min %q: %v", *DateMin, err)
-	} else if ok {
-		filters = filters.Append(func(n *loader.Note) bool {
-			return n.CreatedMicros.Time().UnixNano() >= dateMin.UnixNano()
-		})
+func runExport(cfg *config.Config, _ []string) error {
+	var plan *keep.Plan
+	var skipped func(*loader.Note, string)
+	if *DryRun {
+		plan = &keep.Plan{}
+		skipped = plan.AddSkipped
+		// rejects are still listed in the report, a dry run doesn't copy them anywhere
+		planned := *cfg
+		planned.Source.QuarantineDir = ""
+		cfg = &planned
+	}
+	filters, err := export.NewFilters(cfg, startTime)
+	if err != nil {
+		return err
+	}
+	transformers, err := export.NewTransformers(cfg)
+	if err != nil {
+		return err
+	}
+	fileGenerator := export.NewFileGenerator(cfg)
+	sink, err := export.NewSink(cfg)
+	if err != nil {
+		return err
+	}
+	writers, err := export.NewWriters(cfg, sink, fileGenerator, plan, *StdOut)
+	if err != nil {
+		return err
 	}
 
-	if dateMax, ok, err := dateParser(*DateMax); err != nil {
-		glog.Fatalf("error parsing date max %q: %v", *DateMax, err)
-	} else if ok {
-		filters = filters.Append(func(n *loader.Note) bool {
-			return n.CreatedMicros.Time().UnixNano() >= dateMax.UnixNano()
-		})
+	// rejects and duplicates are passed on the reading goroutine so no lock needed
+	var rejects []loader.Reject
+	var duplicates []dedup.Group
+	var duplicateSkips []*loader.Note
+	source, err := export.NewSource(cfg, startTime, export.SourceHooks{
+		OnReject: func(r loader.Reject) {
+			rejects = append(rejects, r)
+		},
+		OnDuplicate: func(g dedup.Group) {
+			duplicates = append(duplicates, g)
+		},
+		OnSkip: func(n *loader.Note, reason string) {
+			duplicateSkips = append(duplicateSkips, n)
+			if skipped != nil {
+				skipped(n, reason)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	report, runErr := export.Run(context.Background(), export.Options{
+		Source:       source,
+		Filters:      filters,
+		Transformers: transformers,
+		Writers:      writers.Writers,
+		Parallelism:  cfg.Output.Parallelism,
+		KeepGoing:    cfg.Output.KeepGoing,
+		OnSkip:       skipped,
+	})
+	report.Rejects = rejects
+	report.Duplicates = duplicates
+	for _, n := range duplicateSkips {
+		report.AddSkipped(n, dedup.SkipReason)
+	}
+	if err := printReport(report, cfg.Output.ReportFormat); err != nil {
+		return err
+	}
+	if runErr != nil && !cfg.Output.KeepGoing {
+		return runErr // cut short, leave any previous outputs alone
 	}
 
-	reader := loader.ZipToNoteReader{
-		SubFolderPath: *SubFolderPath,
-		DefaultTags:   strings.Split(*DefaultTags, ","),
-		Filter:        filters.AndFilter(),
+	if plan != nil {
+		plan.AddCollisions(fileGenerator.Collisions()...)
+		plan.Sort()
+		if err := printPlan(plan); err != nil {
+			return err
+		}
+		return runErr
+	}
+	if err := export.Finish(cfg, report, sink, transformers, writers, startTime, os.Stdout); err != nil {
+		return err
 	}
+	return runErr
+}
 
-	writers := loadWriters()
+// printReport writes the run report to stderr so it doesn't mix with plans or notes on stdout.
+func printReport(report *export.Report, format string) error {
+	switch format {
+	case "none":
+		return nil
+	case "json":
+		return report.PrintJSON(os.Stderr)
+	case "", "table":
+		return report.PrintTable(os.Stderr)
+	}
+	return fmt.Errorf("unknown --report_format %q", format)
+}
 
-	g := new(errgroup.Group)
-	if err := reader.StreamNotes(*ZipFilePath, func(note *loader.Note) error {
-		n := note // local ref
+func printPlan(plan *keep.Plan) error {
+	switch *DryRunFormat {
+	case "json":
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(plan)
+	case "text":
+		plan.Print(os.Stdout)
+		return nil
+	}
+	return fmt.Errorf("unknown --dry_run_format %q", *DryRunFormat)
+}
 
-		for _, wc := range writers {
-			wc := wc // local ref
-			g.Go(func() error {
-				return wc.WriteNote(n)
-			})
+// parseArgs parses flags from args allowing them to be mixed with positional arguments, eg: `search foo --date_min=2020-01-01`
+func parseArgs(args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flag.CommandLine.Parse(args); err != nil {
+			return nil, err
 		}
+		args = flag.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
 
-		return nil
-	}); err != nil {
-		glog.Fatalf("error reading notes from zip file %s: %v", *ZipFilePath, err)
+func main() {
+	flag.Usage = usage
+	name, args := defaultCommand, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	args, err := parseArgs(args)
+	if err != nil {
+		glog.Fatalf("error parsing flags: %v", err)
 	}
-	if err := g.Wait(); err != nil {
-		glog.Errorf("error writing notes: %v", err)
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		glog.Fatalf("unknown command %q", name)
 	}
 
-	for _, wc := range writers {
-		if err := wc.Flush(); err != nil {
-			glog.Errorf("error flushing writer: %v", err)
-		}
+	cfg, err := loadConfig()
+	if err != nil {
+		glog.Fatalf("error loading config: %v", err)
+	}
+	if err := cmd.run(cfg, args); err != nil {
+		glog.Exitf("error running %s: %v", name, err)
 	}
 }